@@ -4,15 +4,19 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"github.com/blissfulreboot/slagbot/internal/authorization"
 	"github.com/blissfulreboot/slagbot/internal/commandparser"
 	"github.com/blissfulreboot/slagbot/internal/configuration"
+	"github.com/blissfulreboot/slagbot/internal/metrics"
 	"github.com/blissfulreboot/slagbot/internal/pluginloader"
 	"github.com/blissfulreboot/slagbot/internal/slackconnection"
 	"github.com/blissfulreboot/slagbot/pkg/logging"
 	"github.com/blissfulreboot/slagbot/pkg/types"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -31,9 +35,24 @@ func main() {
 
 	incomingMessagesChannel := make(chan slackconnection.SlackMessage)
 	outgoingMessageChannel := make(chan types.OutgoingSlackMessage)
+	interactionChannel := make(chan slackconnection.SlackInteraction)
+
+	metrics.Serve(conf.MetricsListenAddress, logger, wg, ctx)
+
+	pluginDiscovery := pluginloader.Discovery{
+		Dirs:                conf.PluginDirectories(),
+		Recursive:           conf.PluginRecursive,
+		PluginExtension:     conf.PluginExtension,
+		ExecPluginExtension: conf.ExecPluginExtension,
+		Include:             conf.PluginInclude,
+		Exclude:             conf.PluginExclude,
+		Disabled:            conf.DisabledPlugins,
+		ReadDisabled:        configuration.ReadDisabledPlugins,
+	}
 
-	plugins, pluginLoaderErr := pluginloader.LoadPlugins(conf.PluginDir, conf.PluginExtension, conf.PluginExitGraceSeconds,
-		logger, outgoingMessageChannel, wg, ctx)
+	plugins, pluginLoaderErr := pluginloader.LoadPlugins(pluginDiscovery, commandparser.PrepareCommands,
+		conf.PluginExitGraceSeconds, conf.PluginReloadSeconds, conf.PluginQueueSize, conf.PluginQueueTimeoutMs,
+		conf.AdminChannel, logger, outgoingMessageChannel, wg, ctx)
 
 	if pluginLoaderErr != nil {
 		logger.Error(pluginLoaderErr)
@@ -41,7 +60,28 @@ func main() {
 	}
 	logger.Debug("After utils.LoadPlugins")
 
-	commandHandler := commandparser.NewCommandHandler(incomingMessagesChannel, outgoingMessageChannel, plugins, logger)
+	mockUserLookup := func(userID string) (*types.UserProfile, error) {
+		return &types.UserProfile{
+			ID:          userID,
+			Name:        "mockuser",
+			DisplayName: "Mock User",
+			RealName:    "Mock User",
+			Email:       "mock.user@example.com",
+		}, nil
+	}
+
+	triggerPolicy := commandparser.TriggerPolicy{
+		Mode:                 conf.TriggerMode,
+		Prefix:               conf.CommandPrefix,
+		AcceptDirectMessages: conf.AcceptDirectMessages,
+		ChannelModes:         conf.ChannelTriggerModes,
+	}
+
+	// User groups are not available without Slack
+	authorizer := authorization.NewAuthorizer(conf.Roles, conf.CommandPolicies, mockUserLookup, nil, logger)
+
+	commandHandler := commandparser.NewCommandHandler(incomingMessagesChannel, interactionChannel,
+		outgoingMessageChannel, plugins, mockUserLookup, authorizer, triggerPolicy, logger)
 	logger.Debug("After utils.NewCommandHandler")
 
 	commandHandler.StartCommandHandlingLoop(wg, ctx)
@@ -55,11 +95,18 @@ func main() {
 		for {
 			select {
 			case msg := <-outgoingMessageChannel:
-				fmt.Println("Received message from a plugin")
-				fmt.Printf("Content of the message: %+v\n\n", msg)
+				printOutgoingMessage(msg)
 			case <-ctx.Done():
-				fmt.Println("Closing outgoing message listener")
-				return
+				// Print the messages the plugins send while they are stopped
+				for {
+					select {
+					case msg := <-outgoingMessageChannel:
+						printOutgoingMessage(msg)
+					case <-plugins.Stopped():
+						fmt.Println("Closing outgoing message listener")
+						return
+					}
+				}
 			}
 		}
 	}()
@@ -69,7 +116,9 @@ func main() {
 		wg.Add(1)
 		defer wg.Done()
 		time.Sleep(3 * time.Second)
-		fmt.Println("Write to simulate slack messages going to the bot (no need to address the bot).")
+		fmt.Println("Write to simulate slack messages going to the bot (the bot is considered mentioned).")
+		fmt.Println("Write 'click <action id> [value]' to simulate a click of a button.")
+		fmt.Println("Write '/<command> [text]' to simulate a slash command.")
 		textChannel := make(chan string)
 		go func() {
 			scanner := bufio.NewScanner(os.Stdin)
@@ -86,10 +135,39 @@ func main() {
 		for {
 			select {
 			case text := <-textChannel:
+				now := time.Now()
+				if fields := strings.Fields(text); len(fields) > 1 && fields[0] == "click" {
+					interaction := slackconnection.SlackInteraction{
+						User:             "MockUser",
+						Channel:          "MockChannel",
+						MessageTimestamp: fmt.Sprintf("%d.%06d", now.Unix(), now.Nanosecond()/1000),
+						Interaction: types.Interaction{
+							Type:     types.BlockAction,
+							ActionID: fields[1],
+							Value:    strings.Join(fields[2:], " "),
+						},
+					}
+					interactionChannel <- interaction
+					continue
+				}
+				if strings.HasPrefix(text, "/") {
+					slashCommand, commandText, _ := strings.Cut(text, " ")
+					incomingMessagesChannel <- slackconnection.SlackMessage{
+						User:         "MockUser",
+						Text:         commandText,
+						Channel:      "MockChannel",
+						Mentioned:    true,
+						SlashCommand: slashCommand,
+						ResponseURL:  "https://hooks.slack.com/commands/mock",
+					}
+					continue
+				}
 				msg := slackconnection.SlackMessage{
-					User:    "MockUser",
-					Text:    text,
-					Channel: "MockChannel",
+					User:      "MockUser",
+					Text:      text,
+					Channel:   "MockChannel",
+					Timestamp: fmt.Sprintf("%d.%06d", now.Unix(), now.Nanosecond()/1000),
+					Mentioned: true,
 				}
 				incomingMessagesChannel <- msg
 			case <-ctx.Done():
@@ -102,14 +180,45 @@ func main() {
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
+	// SIGHUP reloads the plugins
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	wg.Add(1)
 	go func() {
-		wg.Add(1)
 		defer wg.Done()
-
-		<-c
-		cancel()
+		for {
+			select {
+			case <-hup:
+				logger.Info("SIGHUP received, reloading plugins")
+				if reloadErr := plugins.Reload(); reloadErr != nil {
+					logger.Error("Failed to reload the plugins")
+					logger.Debug(reloadErr)
+				}
+			case <-c:
+				cancel()
+				return
+			}
+		}
 	}()
 
 	wg.Wait()
 
 }
+
+// printOutgoingMessage prints the message and returns a fake ts to the plugin if it asked for the result
+func printOutgoingMessage(msg types.OutgoingSlackMessage) {
+	fmt.Println("Received message from a plugin")
+	fmt.Printf("Content of the message: %+v\n\n", msg)
+	if msg.Result == nil {
+		return
+	}
+	timestamp := msg.Timestamp
+	if timestamp == "" {
+		now := time.Now()
+		timestamp = fmt.Sprintf("%d.%06d", now.Unix(), now.Nanosecond()/1000)
+	}
+	select {
+	case msg.Result <- types.OutgoingResult{Channel: msg.Channel, Timestamp: timestamp}:
+	default:
+	}
+}
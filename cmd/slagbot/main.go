@@ -3,14 +3,17 @@ package main
 import (
 	"context"
 	"fmt"
+	"github.com/blissfulreboot/slagbot/internal/authorization"
 	"github.com/blissfulreboot/slagbot/internal/commandparser"
 	"github.com/blissfulreboot/slagbot/internal/configuration"
+	"github.com/blissfulreboot/slagbot/internal/metrics"
 	"github.com/blissfulreboot/slagbot/internal/pluginloader"
 	"github.com/blissfulreboot/slagbot/internal/slackconnection"
 	"github.com/blissfulreboot/slagbot/pkg/logging"
 	"os"
 	"os/signal"
 	"sync"
+	"syscall"
 )
 
 func main() {
@@ -26,27 +29,68 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	slackbot, botCreateErr := slackconnection.NewBot(conf.SlackAppToken, conf.SlackBotToken, logger)
+	outgoingOptions := slackconnection.OutgoingOptions{
+		ChannelIntervalMillis: conf.OutgoingIntervalMs,
+		ChannelBurst:          conf.OutgoingBurst,
+		QueueSize:             conf.OutgoingQueueSize,
+		MaxRetries:            conf.OutgoingMaxRetries,
+		SplitLength:           conf.OutgoingSplitLength,
+		UploadLength:          conf.OutgoingUploadLength,
+	}
+	slackbot, botCreateErr := slackconnection.NewBot(conf.SlackAppToken, conf.SlackBotToken, outgoingOptions, logger)
 	if botCreateErr != nil {
 		logger.Error(botCreateErr.Error())
 		return
 	}
 
+	// Keep posting the messages of the plugins while they are being stopped. The channel is given before starting the
+	// bot, and closed when the plugins have stopped or could not be loaded.
+	pluginsStopped := make(chan struct{})
+	slackbot.FlushMessagesUntil(pluginsStopped)
 	slackbot.Start(wg, ctx)
 
 	logger.Debug("After slackconnection.Start")
 
-	plugins, pluginLoaderErr := pluginloader.LoadPlugins(conf.PluginDir, conf.PluginExtension, conf.PluginExitGraceSeconds,
-		logger, slackbot.OutgoingMessageChannel, wg, ctx)
+	metrics.Serve(conf.MetricsListenAddress, logger, wg, ctx)
+
+	pluginDiscovery := pluginloader.Discovery{
+		Dirs:                conf.PluginDirectories(),
+		Recursive:           conf.PluginRecursive,
+		PluginExtension:     conf.PluginExtension,
+		ExecPluginExtension: conf.ExecPluginExtension,
+		Include:             conf.PluginInclude,
+		Exclude:             conf.PluginExclude,
+		Disabled:            conf.DisabledPlugins,
+		ReadDisabled:        configuration.ReadDisabledPlugins,
+	}
+
+	plugins, pluginLoaderErr := pluginloader.LoadPlugins(pluginDiscovery, commandparser.PrepareCommands,
+		conf.PluginExitGraceSeconds, conf.PluginReloadSeconds, conf.PluginQueueSize, conf.PluginQueueTimeoutMs,
+		conf.AdminChannel, logger, slackbot.OutgoingMessageChannel, wg, ctx)
 
 	if pluginLoaderErr != nil {
+		close(pluginsStopped)
 		logger.Error(pluginLoaderErr.Error())
 		return
 	}
 	logger.Debug("After utils.LoadPlugins")
+	go func() {
+		<-plugins.Stopped()
+		close(pluginsStopped)
+	}()
+
+	triggerPolicy := commandparser.TriggerPolicy{
+		Mode:                 conf.TriggerMode,
+		Prefix:               conf.CommandPrefix,
+		AcceptDirectMessages: conf.AcceptDirectMessages,
+		ChannelModes:         conf.ChannelTriggerModes,
+	}
 
-	commandHandler := commandparser.NewCommandHandler(slackbot.IncomingMessageChannel, slackbot.OutgoingMessageChannel,
-		plugins, logger)
+	authorizer := authorization.NewAuthorizer(conf.Roles, conf.CommandPolicies, slackbot.LookupUser,
+		slackbot.UserGroupMembers, logger)
+
+	commandHandler := commandparser.NewCommandHandler(slackbot.IncomingMessageChannel, slackbot.InteractionChannel,
+		slackbot.OutgoingMessageChannel, plugins, slackbot.LookupUser, authorizer, triggerPolicy, logger)
 	logger.Debug("After utils.NewCommandHandler")
 
 	commandHandler.StartCommandHandlingLoop(wg, ctx)
@@ -54,12 +98,25 @@ func main() {
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
+	// SIGHUP reloads the plugins
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	wg.Add(1)
 	go func() {
-		wg.Add(1)
 		defer wg.Done()
-
-		<-c
-		cancel()
+		for {
+			select {
+			case <-hup:
+				logger.Info("SIGHUP received, reloading plugins")
+				if reloadErr := plugins.Reload(); reloadErr != nil {
+					logger.Error("Failed to reload the plugins")
+					logger.Debug(reloadErr)
+				}
+			case <-c:
+				cancel()
+				return
+			}
+		}
 	}()
 
 	wg.Wait()
@@ -0,0 +1,32 @@
+#!/usr/bin/env python3
+# Minimal executable plugin. Copy it to the plugin directory as "execplugin.exec" and make it executable.
+import json
+import sys
+
+COMMANDS = [{
+    "keyword": "ping",
+    "description": "Responds with pong",
+    "params": [],
+}]
+
+
+def send(message):
+    sys.stdout.write(json.dumps(message) + "\n")
+    sys.stdout.flush()
+
+
+for line in sys.stdin:
+    msg = json.loads(line)
+    method = msg.get("method")
+    if method == "GetCommands":
+        send({"jsonrpc": "2.0", "id": msg["id"], "result": COMMANDS})
+    elif method == "ParsedCommand":
+        cmd = msg["params"]
+        print("Received " + cmd["command"], file=sys.stderr)
+        send({"jsonrpc": "2.0", "method": "OutgoingSlackMessage",
+              "params": {"channel": cmd["channel"], "user_email": "", "message": "pong",
+                         "thread_ts": cmd["thread_ts"] or cmd["message_ts"]}})
+    elif method == "Stop":
+        break
+    elif "id" in msg:
+        send({"jsonrpc": "2.0", "id": msg["id"], "error": {"code": -32601, "message": "Method not found"}})
@@ -4,7 +4,6 @@ import (
 	"context"
 	"github.com/blissfulreboot/slagbot/pkg/interfaces"
 	"github.com/blissfulreboot/slagbot/pkg/types"
-	"strings"
 )
 
 var commandChannel chan types.ParsedCommand
@@ -25,6 +24,9 @@ func Run(cmdChannel chan types.ParsedCommand, slackMsgChannel chan<- types.Outgo
 			case cmd := <-cmdChannel:
 				logger.Info("Received: " + cmd.Command)
 				logger.Info("Channel: " + cmd.Channel)
+				if profile, profileErr := cmd.User.Profile(); profileErr == nil {
+					logger.Info("User: " + profile.DisplayName)
+				}
 				for key, arg := range cmd.Arguments {
 					logger.Info(key, ": ", arg)
 				}
@@ -32,13 +34,14 @@ func Run(cmdChannel chan types.ParsedCommand, slackMsgChannel chan<- types.Outgo
 				switch cmd.Command {
 				case "blissfulreboot":
 					slackMsgChannel <- types.OutgoingSlackMessage{
-						Channel:   cmd.Channel,
-						UserEmail: "",
-						Message:   "Thanks!",
+						Channel:         cmd.Channel,
+						UserEmail:       "",
+						Message:         "Thanks!",
+						ThreadTimestamp: cmd.ReplyThreadTimestamp(),
 					}
 				case "on the channel":
-					email, ok := cmd.Arguments["is very nice to"]
-					if !ok {
+					email, err := cmd.Arguments.String("is very nice to")
+					if err != nil {
 						slackMsgChannel <- types.OutgoingSlackMessage{
 							Channel:   cmd.Channel,
 							UserEmail: "",
@@ -46,17 +49,10 @@ func Run(cmdChannel chan types.ParsedCommand, slackMsgChannel chan<- types.Outgo
 						}
 						continue
 					}
-					emailString, ok := email.(string)
-					if !ok {
-						logger.Info("Email is not a string")
-						continue
-					}
-					firstParts := strings.Split(emailString, "|")
-					finalParts := strings.Split(firstParts[0], ":")
 
 					slackMsgChannel <- types.OutgoingSlackMessage{
 						Channel:   "",
-						UserEmail: finalParts[len(finalParts)-1],
+						UserEmail: email,
 						Message:   "Which is great, I think!",
 					}
 				}
@@ -93,6 +89,7 @@ func GetCommands() []types.Command {
 				Keyword:     "is very nice to",
 				Description: "foobar",
 				Type:        "before",
+				ValueType:   types.EmailValue,
 			},
 		},
 	}}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/blissfulreboot/slagbot/pkg/blocks"
+	"github.com/blissfulreboot/slagbot/pkg/pluginapi"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"time"
+)
+
+type greeter struct {
+	host pluginapi.Host
+}
+
+var Plugin pluginapi.Plugin = &greeter{}
+
+func (g *greeter) Init(ctx context.Context, host pluginapi.Host) error {
+	g.host = host
+	host.Logger().Info("Greeter initialized")
+	return nil
+}
+
+// InteractionIDs makes the clicks of the buttons whose action ids start with "greet:" come back to the plugin
+func (g *greeter) InteractionIDs() []string {
+	return []string{"greet:"}
+}
+
+func (g *greeter) Commands() []types.Command {
+	return []types.Command{{
+		Keyword:     "greet everyone",
+		Description: "Asks for an approval before greeting the channel",
+	}, {
+		Keyword:      "greet",
+		Description:  "Greets a user",
+		SlashCommand: "/greet",
+		Params: []types.Parameter{
+			{
+				Keyword:     "user",
+				Description: "The user to greet",
+				Type:        types.Positional,
+				ValueType:   types.UserValue,
+			},
+			{
+				Keyword:     "after",
+				Description: "Wait before greeting",
+				Type:        types.After,
+				ValueType:   types.DurationValue,
+				Optional:    true,
+				Default:     "0s",
+			},
+		},
+	}}
+}
+
+func (g *greeter) Handle(ctx context.Context, req *pluginapi.Request) error {
+	if req.Interaction != nil {
+		return g.handleApproval(req)
+	}
+	if req.Command == "greet everyone" {
+		g.host.Send(types.OutgoingSlackMessage{
+			Channel:         req.Channel,
+			Message:         "Greet everyone?",
+			ThreadTimestamp: req.ReplyThreadTimestamp(),
+			Blocks: blocks.Message(
+				blocks.Section(fmt.Sprintf("<@%s> wants to greet everyone. Approve?", req.User.ID)),
+				blocks.Actions("",
+					blocks.PrimaryButton("greet:approve", "Approve", req.User.ID),
+					blocks.DangerButton("greet:reject", "Reject", req.User.ID),
+				),
+			),
+		})
+		return nil
+	}
+
+	user, err := req.Arguments.User("user")
+	if err != nil {
+		return err
+	}
+	wait, err := req.Arguments.Duration("after")
+	if err != nil {
+		return err
+	}
+
+	if wait == 0 {
+		req.Reply(fmt.Sprintf("Hello <@%s>!", user.ID))
+		return nil
+	}
+
+	// Tell that the command was received and update the same message when the wait is over
+	req.React("eyes")
+	posted, postErr := g.host.SendAndWait(ctx, types.OutgoingSlackMessage{
+		Channel:         req.Channel,
+		Message:         fmt.Sprintf("Greeting <@%s> in %s...", user.ID, wait),
+		ThreadTimestamp: req.ReplyThreadTimestamp(),
+	})
+	if postErr != nil {
+		g.host.Logger().Errorf("Could not post the greeting: %s", postErr)
+	}
+
+	select {
+	case <-time.After(wait):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if postErr != nil {
+		req.Reply(fmt.Sprintf("Hello <@%s>!", user.ID))
+	} else if _, updateErr := g.host.SendAndWait(ctx, types.OutgoingSlackMessage{
+		Operation: types.UpdateMessage,
+		Channel:   posted.Channel,
+		Timestamp: posted.Timestamp,
+		Message:   fmt.Sprintf("Hello <@%s>!", user.ID),
+	}); updateErr != nil {
+		g.host.Logger().Errorf("Could not update the greeting: %s", updateErr)
+	}
+	req.Unreact("eyes")
+	req.React("white_check_mark")
+	return nil
+}
+
+func (g *greeter) handleApproval(req *pluginapi.Request) error {
+	switch req.Interaction.ActionID {
+	case "greet:approve":
+		req.Reply(fmt.Sprintf("Approved by <@%s>. Hello everyone!", req.User.ID))
+	case "greet:reject":
+		req.Reply(fmt.Sprintf("Rejected by <@%s>.", req.User.ID))
+	}
+	return nil
+}
@@ -3,14 +3,14 @@ module github.com/blissfulreboot/slagbot
 go 1.19
 
 require (
-	github.com/slack-go/slack v0.11.2
+	github.com/slack-go/slack v0.12.5
 	gitlab.com/blissfulreboot/golang/conffee v1.0.1
+	go.uber.org/zap v1.23.0
 )
 
 require (
 	github.com/gorilla/websocket v1.4.2 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
 	go.uber.org/multierr v1.6.0 // indirect
-	go.uber.org/zap v1.23.0 // indirect
 	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
 )
@@ -0,0 +1,179 @@
+package authorization
+
+import (
+	"fmt"
+	"github.com/blissfulreboot/slagbot/internal/configuration"
+	"github.com/blissfulreboot/slagbot/pkg/interfaces"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"sort"
+	"strings"
+)
+
+type UserGroupMembersFunc func(groupID string) ([]string, error)
+
+// AccessDeniedError is returned when the user is not allowed to use the command in the channel. Command is empty for
+// interactions.
+type AccessDeniedError struct {
+	Command string
+	Reason  string
+}
+
+func (e *AccessDeniedError) Error() string {
+	if e.Command == "" {
+		return fmt.Sprintf("access denied: %s", e.Reason)
+	}
+	return fmt.Sprintf("access to command '%s' denied: %s", e.Command, e.Reason)
+}
+
+type Authorizer struct {
+	roles            map[string]configuration.RoleDefinition
+	policies         []configuration.CommandPolicy
+	userLookup       types.UserLookupFunc
+	userGroupMembers UserGroupMembersFunc
+	logger           interfaces.LoggerInterface
+}
+
+func NewAuthorizer(roles map[string]configuration.RoleDefinition, policies []configuration.CommandPolicy,
+	userLookup types.UserLookupFunc, userGroupMembers UserGroupMembersFunc,
+	logger interfaces.LoggerInterface) *Authorizer {
+	return &Authorizer{
+		roles:            roles,
+		policies:         policies,
+		userLookup:       userLookup,
+		userGroupMembers: userGroupMembers,
+		logger:           logger,
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isDirectMessage checks the channel id. Direct message channel ids start with D.
+func isDirectMessage(channel string) bool {
+	return strings.HasPrefix(channel, "D")
+}
+
+// policySpecificity ranks the policy. A policy for a longer command is more specific than a policy for its parent
+// command. A policy for the plugin and the command is more specific than a policy for the same command, which is more
+// specific than a policy for the plugin and a global policy.
+func policySpecificity(policy *configuration.CommandPolicy) int {
+	specificity := 2 * len(strings.Fields(policy.Command))
+	if policy.Plugin != "" {
+		specificity += 1
+	}
+	return specificity
+}
+
+// matchesCommand tells if the policy command is the command or one of its parent commands, e.g. a policy for
+// "jira issue" matches "jira issue delete".
+func matchesCommand(policyCommand string, command string) bool {
+	return command == policyCommand || strings.HasPrefix(command, policyCommand+" ")
+}
+
+// findPolicies returns the policies that match the command, the most specific first.
+func (a *Authorizer) findPolicies(plugin string, command string) []*configuration.CommandPolicy {
+	var found []*configuration.CommandPolicy
+	for i := range a.policies {
+		policy := &a.policies[i]
+		if policy.Plugin != "" && policy.Plugin != plugin {
+			continue
+		}
+		if policy.Command != "" && !matchesCommand(policy.Command, command) {
+			continue
+		}
+		found = append(found, policy)
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return policySpecificity(found[i]) > policySpecificity(found[j])
+	})
+	return found
+}
+
+func (a *Authorizer) hasRole(userID string, roleName string) bool {
+	role, ok := a.roles[roleName]
+	if !ok {
+		a.logger.Errorf("Role %s is not defined in the configuration", roleName)
+		return false
+	}
+	if contains(role.Users, userID) {
+		return true
+	}
+	if len(role.Emails) > 0 && a.userLookup != nil {
+		profile, lookupErr := a.userLookup(userID)
+		if lookupErr != nil {
+			a.logger.Errorf("Could not resolve the email of user %s", userID)
+			a.logger.Debug(lookupErr)
+		} else if profile.Email != "" && contains(role.Emails, profile.Email) {
+			return true
+		}
+	}
+	if a.userGroupMembers != nil {
+		for _, group := range role.UserGroups {
+			members, membersErr := a.userGroupMembers(group)
+			if membersErr != nil {
+				a.logger.Errorf("Could not get the members of user group %s", group)
+				a.logger.Debug(membersErr)
+				continue
+			}
+			if contains(members, userID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Authorize checks if the user can use the command of the plugin in the channel.
+func (a *Authorizer) Authorize(userID string, channel string, plugin string, cmd types.Command) error {
+	return a.authorize(userID, channel, true, plugin, cmd.Keyword, cmd.RequiredRole)
+}
+
+// AuthorizeInteraction checks if the user can use the buttons, menus and modals of the plugin. Only the policies
+// without a command apply. Modals are not in a channel, so the channel restrictions are not checked when the channel
+// is empty; the command that opened the modal has been checked in its channel.
+func (a *Authorizer) AuthorizeInteraction(userID string, channel string, plugin string) error {
+	return a.authorize(userID, channel, channel != "", plugin, "", "")
+}
+
+func (a *Authorizer) authorize(userID string, channel string, checkChannel bool, plugin string, command string,
+	requiredRole string) error {
+	var allowedRoles []string
+	if requiredRole != "" {
+		allowedRoles = []string{requiredRole}
+	}
+
+	// The channel restrictions of all matching policies apply, but the roles of the most specific policy that lists
+	// roles replace the others
+	rolesFound := false
+	for _, policy := range a.findPolicies(plugin, command) {
+		if checkChannel && policy.DirectMessageOnly && !isDirectMessage(channel) {
+			return &AccessDeniedError{Command: command, Reason: "the command can only be used in direct messages"}
+		}
+		if checkChannel && len(policy.AllowedChannels) > 0 && !contains(policy.AllowedChannels, channel) {
+			return &AccessDeniedError{Command: command, Reason: "the command cannot be used in this channel"}
+		}
+		if len(policy.AllowedRoles) > 0 && !rolesFound {
+			allowedRoles = policy.AllowedRoles
+			rolesFound = true
+		}
+	}
+
+	if len(allowedRoles) == 0 {
+		return nil
+	}
+	for _, role := range allowedRoles {
+		if a.hasRole(userID, role) {
+			return nil
+		}
+	}
+	return &AccessDeniedError{
+		Command: command,
+		Reason:  fmt.Sprintf("one of the roles %s is required", strings.Join(allowedRoles, ", ")),
+	}
+}
@@ -0,0 +1,97 @@
+package authorization
+
+import (
+	"errors"
+	"github.com/blissfulreboot/slagbot/internal/configuration"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	roles := map[string]configuration.RoleDefinition{
+		"admin": {Users: []string{"UADMIN"}},
+		"dev":   {Users: []string{"UDEV"}},
+	}
+	policies := []configuration.CommandPolicy{
+		{Plugin: "jira.plugin", AllowedRoles: []string{"dev", "admin"}},
+		{Command: "jira issue", AllowedRoles: []string{"admin"}},
+		{Command: "jira issue list", AllowedRoles: []string{"dev"}},
+		{Command: "deploy", AllowedChannels: []string{"CDEPLOY"}},
+		{Command: "rotate secrets", DirectMessageOnly: true},
+	}
+	authorizer := NewAuthorizer(roles, policies, nil, nil, zap.NewNop().Sugar())
+
+	tests := []struct {
+		name    string
+		user    string
+		channel string
+		plugin  string
+		command types.Command
+		allowed bool
+	}{
+		{name: "plugin policy", user: "UDEV", channel: "C1", plugin: "jira.plugin",
+			command: types.Command{Keyword: "jira search"}, allowed: true},
+		{name: "command policy", user: "UDEV", channel: "C1", plugin: "jira.plugin",
+			command: types.Command{Keyword: "jira issue"}},
+		{name: "subcommand of a restricted command", user: "UDEV", channel: "C1", plugin: "jira.plugin",
+			command: types.Command{Keyword: "jira issue delete"}},
+		{name: "subcommand with its own policy", user: "UDEV", channel: "C1", plugin: "jira.plugin",
+			command: types.Command{Keyword: "jira issue list"}, allowed: true},
+		{name: "admin", user: "UADMIN", channel: "C1", plugin: "jira.plugin",
+			command: types.Command{Keyword: "jira issue delete"}, allowed: true},
+		{name: "only whole keywords", user: "UDEV", channel: "C1", plugin: "jira.plugin",
+			command: types.Command{Keyword: "jira issues"}, allowed: true},
+		{name: "allowed channel", user: "U1", channel: "CDEPLOY", plugin: "deploy.plugin",
+			command: types.Command{Keyword: "deploy"}, allowed: true},
+		{name: "other channel", user: "U1", channel: "C1", plugin: "deploy.plugin",
+			command: types.Command{Keyword: "deploy"}},
+		{name: "channel restriction of the parent", user: "U1", channel: "C1", plugin: "deploy.plugin",
+			command: types.Command{Keyword: "deploy status"}},
+		{name: "direct message", user: "U1", channel: "D1", plugin: "secrets.plugin",
+			command: types.Command{Keyword: "rotate secrets"}, allowed: true},
+		{name: "not a direct message", user: "U1", channel: "C1", plugin: "secrets.plugin",
+			command: types.Command{Keyword: "rotate secrets"}},
+		{name: "required role", user: "UDEV", channel: "C1", plugin: "other.plugin",
+			command: types.Command{Keyword: "reboot", RequiredRole: "admin"}},
+		{name: "no policy", user: "U1", channel: "C1", plugin: "other.plugin",
+			command: types.Command{Keyword: "reboot"}, allowed: true},
+	}
+	for _, test := range tests {
+		err := authorizer.Authorize(test.user, test.channel, test.plugin, test.command)
+		if test.allowed && err != nil {
+			t.Errorf("%s: Authorize = %v, want allowed", test.name, err)
+		}
+		var deniedErr *AccessDeniedError
+		if !test.allowed && !errors.As(err, &deniedErr) {
+			t.Errorf("%s: Authorize = %v, want AccessDeniedError", test.name, err)
+		}
+	}
+}
+
+func TestAuthorizeInteraction(t *testing.T) {
+	roles := map[string]configuration.RoleDefinition{"admin": {Users: []string{"UADMIN"}}}
+	policies := []configuration.CommandPolicy{
+		{Plugin: "deploy.plugin", AllowedRoles: []string{"admin"}, AllowedChannels: []string{"CDEPLOY"}},
+		{Command: "deploy", AllowedRoles: []string{"nobody"}},
+	}
+	authorizer := NewAuthorizer(roles, policies, nil, nil, zap.NewNop().Sugar())
+
+	tests := []struct {
+		name    string
+		user    string
+		channel string
+		allowed bool
+	}{
+		{name: "admin in the channel", user: "UADMIN", channel: "CDEPLOY", allowed: true},
+		{name: "admin in a modal", user: "UADMIN", allowed: true},
+		{name: "admin in another channel", user: "UADMIN", channel: "C1"},
+		{name: "other user", user: "U1", channel: "CDEPLOY"},
+	}
+	for _, test := range tests {
+		err := authorizer.AuthorizeInteraction(test.user, test.channel, "deploy.plugin")
+		if (err == nil) != test.allowed {
+			t.Errorf("%s: AuthorizeInteraction = %v, want allowed %t", test.name, err, test.allowed)
+		}
+	}
+}
@@ -4,27 +4,37 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/blissfulreboot/slagbot/internal/authorization"
 	"github.com/blissfulreboot/slagbot/internal/pluginloader"
 	"github.com/blissfulreboot/slagbot/internal/slackconnection"
 	"github.com/blissfulreboot/slagbot/pkg/interfaces"
 	"github.com/blissfulreboot/slagbot/pkg/types"
-	"regexp"
 	"strings"
 	"sync"
 )
 
 type CommandHandler struct {
 	incomingMsgChannel chan slackconnection.SlackMessage
+	interactionChannel chan slackconnection.SlackInteraction
 	outgoingMsgChannel chan types.OutgoingSlackMessage
-	plugins            []*pluginloader.ReadyPlugin
+	plugins            *pluginloader.PluginManager
+	userLookup         types.UserLookupFunc
+	authorizer         *authorization.Authorizer
+	trigger            TriggerPolicy
 	logger             interfaces.LoggerInterface
 }
 
-func NewCommandHandler(incoming chan slackconnection.SlackMessage, outgoing chan types.OutgoingSlackMessage,
-	plugins []*pluginloader.ReadyPlugin, logger interfaces.LoggerInterface) *CommandHandler {
+func NewCommandHandler(incoming chan slackconnection.SlackMessage,
+	interactions chan slackconnection.SlackInteraction, outgoing chan types.OutgoingSlackMessage,
+	plugins *pluginloader.PluginManager, userLookup types.UserLookupFunc, authorizer *authorization.Authorizer,
+	trigger TriggerPolicy, logger interfaces.LoggerInterface) *CommandHandler {
 	return &CommandHandler{
 		plugins:            plugins,
+		userLookup:         userLookup,
+		authorizer:         authorizer,
+		trigger:            trigger,
 		incomingMsgChannel: incoming,
+		interactionChannel: interactions,
 		outgoingMsgChannel: outgoing,
 		logger:             logger,
 	}
@@ -42,13 +52,25 @@ func (ch *CommandHandler) StartCommandHandlingLoop(wg *sync.WaitGroup, ctx conte
 				parseErr := ch.handleMessage(msg)
 				if parseErr != nil {
 					ch.logger.Error("Failed to parse the command.")
-					ch.outgoingMsgChannel <- types.OutgoingSlackMessage{
-						Channel:   msg.Channel,
-						UserEmail: "",
-						Message:   "Failed to parse the command",
+					reply := "Failed to parse the command"
+					var cmdErr *commandParseError
+					var ambiguousErr *ambiguousCommandError
+					var unknownErr *unknownCommandError
+					if errors.As(parseErr, &cmdErr) {
+						reply = fmt.Sprintf("Failed to parse the command: %s\nUsage: `%s`", cmdErr.err,
+							commandUsage(cmdErr.command))
+					} else if errors.As(parseErr, &unknownErr) {
+						reply = unknownErr.reply()
+					} else if errors.As(parseErr, &ambiguousErr) {
+						reply = fmt.Sprintf("Ambiguous command, did you mean %s?", ambiguousErr.suggestion())
 					}
+					ch.reply(msg, reply)
 				}
 
+			case interaction := <-ch.interactionChannel:
+				ch.logger.Debugf("StartCommandHandlingLoop received interaction: %+v", interaction)
+				ch.handleInteraction(interaction)
+
 			case <-ctx.Done():
 				ch.logger.Debug("Context done in StartCommandHandlingLoop")
 				return
@@ -58,79 +80,223 @@ func (ch *CommandHandler) StartCommandHandlingLoop(wg *sync.WaitGroup, ctx conte
 	ch.logger.Info("StartCommandHandlingLoop done")
 }
 
-func (ch *CommandHandler) parseArguments(message string, params []types.Parameter) (types.Arguments, error) {
-	var err error
+func (ch *CommandHandler) parseArguments(message string, cmd types.Command) (types.Arguments, error) {
+	if len(cmd.Subcommands) > 0 && !hasOwnParams(cmd) {
+		return nil, errors.New("subcommand is missing")
+	}
+
 	args := make(types.Arguments)
+	tokens := tokenize(message)
+	var missing []string
 
-	for _, param := range params {
-		messageContainsKeyword := strings.Contains(message, param.Keyword)
+	// Tokens that belong to the command keyword or to keyword parameters are not used for positional parameters
+	consumed := make([]bool, len(tokens))
+	commandIndex := findKeyword(tokens, cmd.Keyword)
+	commandEnd := 0
+	if commandIndex != -1 {
+		commandEnd = commandIndex + len(strings.Fields(cmd.Keyword))
+		for i := commandIndex; i < commandEnd; i++ {
+			consumed[i] = true
+		}
+	}
+
+	setMissing := func(param types.Parameter) {
+		if !param.Optional {
+			missing = append(missing, param.Keyword)
+			return
+		}
+		// The defaults have been converted by PrepareCommands when the plugin was loaded
+		if param.Default != nil {
+			args[param.Keyword] = param.Default
+		}
+	}
+
+	var positionalParams []types.Parameter
+	for _, param := range cmd.Params {
+		if param.Type == types.Positional || param.Type == types.Rest {
+			positionalParams = append(positionalParams, param)
+			continue
+		}
+
+		keywordIndex := findKeyword(tokens, param.Keyword)
 
 		// Check if the parameter type is a flag since that requires some special handling
 		if param.Type == types.Flag {
-			args[param.Keyword] = false
-			if messageContainsKeyword {
-				args[param.Keyword] = true
+			args[param.Keyword] = keywordIndex != -1
+			if keywordIndex != -1 {
+				for i := keywordIndex; i < keywordIndex+len(strings.Fields(param.Keyword)); i++ {
+					consumed[i] = true
+				}
 			}
 			continue
 		}
 
-		// Only with flag it is allowed for the Keyword to be absent
-		if !messageContainsKeyword {
-			return nil, errors.New(fmt.Sprintf("could not find Keyword '%s' when parsing arguments", param.Keyword))
+		if keywordIndex == -1 {
+			setMissing(param)
+			continue
 		}
-		// Compile the regexp for getting the argument
-		var re *regexp.Regexp
+
+		// Find the token holding the value
+		keywordEnd := keywordIndex + len(strings.Fields(param.Keyword))
+		valueIndex := -1
 		switch param.Type {
 		case types.Before:
-			re, err = regexp.Compile(fmt.Sprintf("\\s(\\S+)\\s%s", param.Keyword))
+			valueIndex = keywordIndex - 1
 		case types.After:
-			re, err = regexp.Compile(fmt.Sprintf("%s\\s(\\S+)", param.Keyword))
+			valueIndex = keywordEnd
 		default:
 			return nil, errors.New(fmt.Sprintf("unsupported parameter type '%s'", param.Type))
 		}
-		// Handling for regexp compile errors
-		if err != nil {
-			return nil, err
+		if valueIndex < 0 || valueIndex >= len(tokens) {
+			return nil, errors.New(fmt.Sprintf("could not find match/value for parameter %s (param type %s)", param.Keyword, param.Type))
 		}
 
-		results := re.FindStringSubmatch(message)
-		if len(results) == 0 {
-			return nil, errors.New(fmt.Sprintf("could not find match/value for parameter %s (param type %s)", param.Keyword, param.Type))
+		value, convertErr := convertValue(param, tokens[valueIndex])
+		if convertErr != nil {
+			return nil, convertErr
 		}
-		// If there is a match, then there should be at least two items in the slice. This should not be possible, but
-		// perhaps there is some edge case?
-		if len(results) == 1 {
-			return nil, errors.New("only one item in the result slice, how is this possible")
+		args[param.Keyword] = value
+		for i := keywordIndex; i < keywordEnd; i++ {
+			consumed[i] = true
 		}
-		args[param.Keyword] = results[1]
+		consumed[valueIndex] = true
 	}
-	return args, nil
-}
 
-func (ch *CommandHandler) handleMessage(message slackconnection.SlackMessage) error {
-	var msgCommand string
-	var args types.Arguments
-	for _, plug := range ch.plugins {
-		ch.logger.Debugf("Cheking plugin %s for matching commands", plug.File)
-		for _, cmd := range plug.Commands {
-			if !strings.Contains(message.Text, cmd.Keyword) {
+	// Positional parameters take the remaining tokens after the command keyword in order
+	var remaining []token
+	for i := commandEnd; i < len(tokens); i++ {
+		if !consumed[i] {
+			remaining = append(remaining, tokens[i])
+		}
+	}
+	for _, param := range positionalParams {
+		if param.Type == types.Rest {
+			rest := joinTokens(message, remaining)
+			remaining = nil
+			if rest == "" {
+				setMissing(param)
 				continue
 			}
-			msgCommand = cmd.Keyword
-			var err error
-			args, err = ch.parseArguments(message.Text, cmd.Params)
-			if err != nil {
-				return err
-			}
-			plug.CommandChannel <- types.ParsedCommand{
-				Channel:   message.Channel,
-				Command:   msgCommand,
-				Arguments: args,
+			value, convertErr := convertValue(param, token{kind: wordToken, value: rest})
+			if convertErr != nil {
+				return nil, convertErr
 			}
-			return nil
+			args[param.Keyword] = value
+			continue
+		}
+
+		if len(remaining) == 0 {
+			setMissing(param)
+			continue
+		}
+		value, convertErr := convertValue(param, remaining[0])
+		if convertErr != nil {
+			return nil, convertErr
 		}
+		args[param.Keyword] = value
+		remaining = remaining[1:]
+	}
+
+	if len(missing) > 0 {
+		return nil, &MissingParametersError{Keywords: missing}
+	}
+	return args, nil
+}
+
+// hasOwnParams tells if the command can be used without a subcommand. A command with subcommands is only dispatched
+// by itself if it defines parameters.
+func hasOwnParams(cmd types.Command) bool {
+	return len(cmd.Params) > 0
+}
+
+func (ch *CommandHandler) handleMessage(message slackconnection.SlackMessage) error {
+	text, triggered, addressed := ch.trigger.commandText(message)
+	if !triggered {
+		ch.logger.Debugf("Message did not trigger the bot: %+v", message)
+		return nil
+	}
+	message.Text = text
+
+	return ch.plugins.WithPlugins(func(plugins []*pluginloader.ReadyPlugin) error {
+		if message.SlashCommand != "" {
+			return ch.dispatchSlashCommand(message, plugins)
+		}
+		return ch.dispatchMessage(message, addressed, plugins)
+	})
+}
+
+// dispatchMessage answers a help request or runs the command in the message. A message that was not addressed to the
+// bot is most likely just chat, so the bot replies to it only if it matched a command.
+func (ch *CommandHandler) dispatchMessage(message slackconnection.SlackMessage, addressed bool,
+	plugins []*pluginloader.ReadyPlugin) error {
+	if topic, isHelp := helpTopic(message.Text); isHelp {
+		ch.handleHelp(message, topic, addressed, plugins)
+		return nil
+	}
+
+	match, matchErr := matchCommand(tokenize(message.Text), plugins)
+	if matchErr != nil {
+		return matchErr
+	}
+	if match != nil {
+		return ch.runCommand(message, match)
 	}
 	ch.logger.Debugf("Message handled: %+v", message)
 	ch.logger.Debug("No command match found.")
-	return errors.New("no command found")
+	if !addressed {
+		return nil
+	}
+	return &unknownCommandError{suggestions: suggestCommands(tokenize(message.Text), plugins)}
+}
+
+// runCommand authorizes the user, parses the arguments and delivers the matched command to its plugin.
+func (ch *CommandHandler) runCommand(message slackconnection.SlackMessage, match *commandMatch) error {
+	plug := match.plugin
+	cmd := match.command
+	ch.logger.Debugf("Message matched the command %s of plugin %s", cmd.Keyword, plug.File)
+	if authErr := ch.authorizer.Authorize(message.User, message.Channel, plug.File, cmd); authErr != nil {
+		ch.logger.Warnf("User %s was denied the command %s of plugin %s in channel %s: %s", message.User,
+			cmd.Keyword, plug.File, message.Channel, authErr)
+		reply := "Sorry, you are not allowed to use that command"
+		var deniedErr *authorization.AccessDeniedError
+		if errors.As(authErr, &deniedErr) {
+			reply = fmt.Sprintf("Sorry, you are not allowed to use `%s`: %s", cmd.Keyword, deniedErr.Reason)
+		}
+		ch.reply(message, reply)
+		return nil
+	}
+	args, err := ch.parseArguments(message.Text, cmd)
+	if err != nil {
+		return &commandParseError{command: cmd, err: err}
+	}
+	deliverErr := plug.Deliver(types.ParsedCommand{
+		Channel:          message.Channel,
+		User:             types.NewUser(message.User, ch.userLookup),
+		Command:          cmd.Keyword,
+		Arguments:        args,
+		MessageTimestamp: message.Timestamp,
+		ThreadTimestamp:  message.ThreadTimestamp,
+		ResponseURL:      message.ResponseURL,
+		TriggerID:        message.TriggerID,
+	})
+	if deliverErr != nil {
+		ch.logger.Errorf("Could not deliver the command %s to plugin %s", cmd.Keyword, plug.File)
+		ch.logger.Debug(deliverErr)
+		reply := fmt.Sprintf("Sorry, `%s` is temporarily unavailable. Please try again later.", cmd.Keyword)
+		if errors.Is(deliverErr, pluginloader.ErrPluginBusy) {
+			reply = fmt.Sprintf("Sorry, `%s` is busy right now. Please try again later.", cmd.Keyword)
+		}
+		ch.reply(message, reply)
+	}
+	return nil
+}
+
+// reply answers the message in its thread, or only to the user if the message was a slash command.
+func (ch *CommandHandler) reply(message slackconnection.SlackMessage, text string) {
+	ch.outgoingMsgChannel <- types.OutgoingSlackMessage{
+		Channel:         message.Channel,
+		Message:         text,
+		ThreadTimestamp: message.ThreadTimestamp,
+		ResponseURL:     message.ResponseURL,
+	}
 }
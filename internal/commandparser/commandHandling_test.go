@@ -0,0 +1,89 @@
+package commandparser
+
+import (
+	"errors"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testDeployCommand(t *testing.T) types.Command {
+	t.Helper()
+	prepared, err := PrepareCommands([]types.Command{
+		{
+			Keyword: "deploy",
+			Params: []types.Parameter{
+				{Keyword: "service", Type: types.Positional},
+				{Keyword: "to", Type: types.After, ValueType: types.EnumValue, Choices: []string{"dev", "prod"},
+					Optional: true, Default: "dev"},
+				{Keyword: "replicas", Type: types.After, ValueType: types.IntValue, Optional: true,
+					Default: float64(1000000)},
+				{Keyword: "timeout", Type: types.After, ValueType: types.DurationValue, Optional: true},
+				{Keyword: "force", Type: types.Flag},
+				{Keyword: "reason", Type: types.Rest, Optional: true},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prepared[0]
+}
+
+func TestParseArguments(t *testing.T) {
+	tests := []struct {
+		message string
+		want    types.Arguments
+		// missing lists the keywords of the missing parameters if the parsing should fail because of them
+		missing []string
+		wantErr bool
+	}{
+		{
+			message: "deploy api",
+			want:    types.Arguments{"service": "api", "to": "dev", "replicas": 1000000, "force": false},
+		},
+		{
+			message: "deploy api to PROD replicas 3 timeout 5m force",
+			want: types.Arguments{"service": "api", "to": "prod", "replicas": 3, "timeout": 5 * time.Minute,
+				"force": true},
+		},
+		{
+			message: `deploy "my service" force because the tests pass`,
+			want: types.Arguments{"service": "my service", "to": "dev", "replicas": 1000000, "force": true,
+				"reason": "because the tests pass"},
+		},
+		{message: "deploy", missing: []string{"service"}},
+		{message: "deploy api to staging", wantErr: true},
+		{message: "deploy api replicas many", wantErr: true},
+		{message: "deploy api replicas", wantErr: true},
+	}
+	cmd := testDeployCommand(t)
+	ch := newTestHandler()
+	for _, test := range tests {
+		got, err := ch.parseArguments(test.message, cmd)
+		if test.missing != nil {
+			var missingErr *MissingParametersError
+			if !errors.As(err, &missingErr) || !reflect.DeepEqual(missingErr.Keywords, test.missing) {
+				t.Errorf("parseArguments(%q) returned the error %v, want missing %v", test.message, err, test.missing)
+			}
+			continue
+		}
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseArguments(%q) = %v, want an error", test.message, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseArguments(%q) = %#v, %v, want %#v", test.message, got, err, test.want)
+		}
+	}
+}
+
+func TestParseArgumentsSubcommandMissing(t *testing.T) {
+	cmd := types.Command{Keyword: "deploy", Subcommands: []types.Command{{Keyword: "status"}}}
+	if _, err := newTestHandler().parseArguments("deploy", cmd); err == nil {
+		t.Error("parseArguments accepted a command without its subcommand")
+	}
+}
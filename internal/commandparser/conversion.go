@@ -0,0 +1,192 @@
+package commandparser
+
+import (
+	"errors"
+	"fmt"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var slackUserIdRegexp = regexp.MustCompile(`^[UW][A-Z0-9]+$`)
+var slackChannelIdRegexp = regexp.MustCompile(`^[CGD][A-Z0-9]+$`)
+
+// MissingParametersError lists all required parameters that were missing from the message.
+type MissingParametersError struct {
+	Keywords []string
+}
+
+func (e *MissingParametersError) Error() string {
+	return fmt.Sprintf("missing required parameters: '%s'", strings.Join(e.Keywords, "', '"))
+}
+
+func invalidValueError(param types.Parameter, expected string, value string) error {
+	return errors.New(fmt.Sprintf("value '%s' of parameter '%s' is not %s", value, param.Keyword, expected))
+}
+
+func convertUser(param types.Parameter, tok token) (types.SlackUser, error) {
+	if tok.kind == markupToken && strings.HasPrefix(tok.target, "@") && slackUserIdRegexp.MatchString(tok.value) {
+		return types.SlackUser{ID: tok.value, Name: tok.label}, nil
+	}
+	if tok.kind != markupToken && slackUserIdRegexp.MatchString(tok.value) {
+		return types.SlackUser{ID: tok.value}, nil
+	}
+	return types.SlackUser{}, invalidValueError(param, "a user mention", tok.value)
+}
+
+func convertChannel(param types.Parameter, tok token) (types.SlackChannel, error) {
+	if tok.kind == markupToken && strings.HasPrefix(tok.target, "#") && slackChannelIdRegexp.MatchString(tok.value) {
+		return types.SlackChannel{ID: tok.value, Name: tok.label}, nil
+	}
+	if tok.kind != markupToken && slackChannelIdRegexp.MatchString(tok.value) {
+		return types.SlackChannel{ID: tok.value}, nil
+	}
+	return types.SlackChannel{}, invalidValueError(param, "a channel", tok.value)
+}
+
+func convertEmail(param types.Parameter, tok token) (string, error) {
+	address, err := mail.ParseAddress(tok.value)
+	if err != nil || address.Address != tok.value {
+		return "", invalidValueError(param, "an email address", tok.value)
+	}
+	return tok.value, nil
+}
+
+func convertURL(param types.Parameter, tok token) (string, error) {
+	parsed, err := url.ParseRequestURI(tok.value)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return "", invalidValueError(param, "a URL", tok.value)
+	}
+	return tok.value, nil
+}
+
+func convertEnum(param types.Parameter, value string) (string, error) {
+	for _, choice := range param.Choices {
+		if strings.EqualFold(choice, value) {
+			return choice, nil
+		}
+	}
+	return "", invalidValueError(param, fmt.Sprintf("one of %s", strings.Join(param.Choices, ", ")), value)
+}
+
+func convertByValueType(param types.Parameter, tok token) (interface{}, error) {
+	value := tok.value
+	switch param.ValueType {
+	case "", types.StringValue:
+		return value, nil
+	case types.IntValue:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, invalidValueError(param, "an integer", value)
+		}
+		return i, nil
+	case types.FloatValue:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, invalidValueError(param, "a number", value)
+		}
+		return f, nil
+	case types.DurationValue:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, invalidValueError(param, "a duration (e.g. 1h30m)", value)
+		}
+		return d, nil
+	case types.EnumValue:
+		return convertEnum(param, value)
+	case types.UserValue:
+		return convertUser(param, tok)
+	case types.ChannelValue:
+		return convertChannel(param, tok)
+	case types.EmailValue:
+		return convertEmail(param, tok)
+	case types.URLValue:
+		return convertURL(param, tok)
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported value type '%s' in parameter '%s'", param.ValueType,
+			param.Keyword))
+	}
+}
+
+// convertValue validates the value of the parameter and converts it to the parameter's value type. The pattern is
+// matched against the converted value if it is a string, otherwise against the clean value of the token.
+func convertValue(param types.Parameter, tok token) (interface{}, error) {
+	converted, err := convertByValueType(param, tok)
+	if err != nil {
+		return nil, err
+	}
+
+	if param.Pattern != "" {
+		re, compileErr := regexp.Compile(fmt.Sprintf("^(?:%s)$", param.Pattern))
+		if compileErr != nil {
+			return nil, errors.New(fmt.Sprintf("invalid pattern in parameter '%s': %s", param.Keyword, compileErr))
+		}
+		subject := tok.value
+		if s, isString := converted.(string); isString {
+			subject = s
+		}
+		if !re.MatchString(subject) {
+			return nil, invalidValueError(param, fmt.Sprintf("matching the pattern %s", param.Pattern), subject)
+		}
+	}
+	return converted, nil
+}
+
+// defaultValue returns the default value of the parameter converted to the value type like a value given in the
+// message, so that the plugin always gets the same Go type. Defaults that are not strings are formatted first, so
+// e.g. the number 5 from the JSON of an executable plugin becomes an int, and plugins that cannot use the Go types can
+// define defaults such as "5m" for durations.
+func defaultValue(param types.Parameter) (interface{}, error) {
+	var s string
+	switch v := param.Default.(type) {
+	case string:
+		s = v
+	case float64:
+		// JSON numbers are decoded as float64, which fmt.Sprint would format as e.g. "1e+06"
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		s = strconv.FormatFloat(float64(v), 'f', -1, 32)
+	default:
+		s = fmt.Sprint(param.Default)
+	}
+	converted, err := convertValue(param, token{kind: wordToken, value: s})
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid default value of parameter '%s': %s", param.Keyword, err))
+	}
+	return converted, nil
+}
+
+// PrepareCommands converts the defaults of the parameters of the commands and their subcommands to the value types
+// when the plugin is loaded, so that a plugin with an invalid default is rejected instead of failing every time the
+// default is used. The commands are copied, the ones of the plugin are not modified.
+func PrepareCommands(commands []types.Command) ([]types.Command, error) {
+	if len(commands) == 0 {
+		return commands, nil
+	}
+	prepared := make([]types.Command, len(commands))
+	for i, cmd := range commands {
+		params := make([]types.Parameter, len(cmd.Params))
+		for j, param := range cmd.Params {
+			if param.Default != nil {
+				converted, err := defaultValue(param)
+				if err != nil {
+					return nil, errors.New(fmt.Sprintf("command '%s': %s", cmd.Keyword, err))
+				}
+				param.Default = converted
+			}
+			params[j] = param
+		}
+		cmd.Params = params
+		subcommands, err := PrepareCommands(cmd.Subcommands)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("command '%s': %s", cmd.Keyword, err))
+		}
+		cmd.Subcommands = subcommands
+		prepared[i] = cmd
+	}
+	return prepared, nil
+}
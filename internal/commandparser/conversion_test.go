@@ -0,0 +1,148 @@
+package commandparser
+
+import (
+	"encoding/json"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConvertValue(t *testing.T) {
+	tests := []struct {
+		param   types.Parameter
+		tok     token
+		want    interface{}
+		wantErr bool
+	}{
+		{param: types.Parameter{Keyword: "name"}, tok: token{value: "app"}, want: "app"},
+		{param: types.Parameter{Keyword: "n", ValueType: types.IntValue}, tok: token{value: "42"}, want: 42},
+		{param: types.Parameter{Keyword: "n", ValueType: types.IntValue}, tok: token{value: "4.2"}, wantErr: true},
+		{param: types.Parameter{Keyword: "f", ValueType: types.FloatValue}, tok: token{value: "4.2"}, want: 4.2},
+		{param: types.Parameter{Keyword: "d", ValueType: types.DurationValue}, tok: token{value: "1h30m"},
+			want: 90 * time.Minute},
+		{param: types.Parameter{Keyword: "d", ValueType: types.DurationValue}, tok: token{value: "soon"},
+			wantErr: true},
+		{
+			param: types.Parameter{Keyword: "env", ValueType: types.EnumValue, Choices: []string{"dev", "prod"}},
+			tok:   token{value: "PROD"},
+			want:  "prod",
+		},
+		{
+			param:   types.Parameter{Keyword: "env", ValueType: types.EnumValue, Choices: []string{"dev", "prod"}},
+			tok:     token{value: "test"},
+			wantErr: true,
+		},
+		{
+			param: types.Parameter{Keyword: "user", ValueType: types.UserValue},
+			tok:   token{kind: markupToken, target: "@U123", value: "U123", label: "alice"},
+			want:  types.SlackUser{ID: "U123", Name: "alice"},
+		},
+		{param: types.Parameter{Keyword: "user", ValueType: types.UserValue}, tok: token{value: "alice"},
+			wantErr: true},
+		{
+			param: types.Parameter{Keyword: "channel", ValueType: types.ChannelValue},
+			tok:   token{value: "C123"},
+			want:  types.SlackChannel{ID: "C123"},
+		},
+		{param: types.Parameter{Keyword: "mail", ValueType: types.EmailValue}, tok: token{value: "a@b.com"},
+			want: "a@b.com"},
+		{param: types.Parameter{Keyword: "url", ValueType: types.URLValue}, tok: token{value: "example.com"},
+			wantErr: true},
+		{param: types.Parameter{Keyword: "v", Pattern: `v\d+`}, tok: token{value: "v12"}, want: "v12"},
+		{param: types.Parameter{Keyword: "v", Pattern: `v\d+`}, tok: token{value: "v12x"}, wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := convertValue(test.param, test.tok)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("convertValue(%s, %q) = %v, want an error", test.param.ValueType, test.tok.value, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("convertValue(%s, %q) = %#v, %v, want %#v", test.param.ValueType, test.tok.value, got, err,
+				test.want)
+		}
+	}
+}
+
+// jsonDefault decodes the default like the commands of an executable plugin are decoded
+func jsonDefault(t *testing.T, value string) interface{} {
+	t.Helper()
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestDefaultValue(t *testing.T) {
+	tests := []struct {
+		valueType    types.ValueType
+		defaultValue interface{}
+		want         interface{}
+		wantErr      bool
+	}{
+		{valueType: types.IntValue, defaultValue: jsonDefault(t, "1000000"), want: 1000000},
+		{valueType: types.IntValue, defaultValue: jsonDefault(t, "5"), want: 5},
+		{valueType: types.IntValue, defaultValue: 5, want: 5},
+		{valueType: types.IntValue, defaultValue: jsonDefault(t, "1.5"), wantErr: true},
+		{valueType: types.FloatValue, defaultValue: jsonDefault(t, "0.000001"), want: 0.000001},
+		{valueType: types.StringValue, defaultValue: jsonDefault(t, "1000000"), want: "1000000"},
+		{valueType: types.DurationValue, defaultValue: "5m", want: 5 * time.Minute},
+		{valueType: types.DurationValue, defaultValue: 5 * time.Minute, want: 5 * time.Minute},
+		{valueType: types.DurationValue, defaultValue: "later", wantErr: true},
+		{valueType: types.UserValue, defaultValue: "U123", want: types.SlackUser{ID: "U123"}},
+	}
+	for _, test := range tests {
+		param := types.Parameter{Keyword: "p", ValueType: test.valueType, Optional: true, Default: test.defaultValue}
+		got, err := defaultValue(param)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("defaultValue(%s, %#v) = %#v, want an error", test.valueType, test.defaultValue, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("defaultValue(%s, %#v) = %#v, %v, want %#v", test.valueType, test.defaultValue, got, err,
+				test.want)
+		}
+	}
+}
+
+func TestPrepareCommands(t *testing.T) {
+	params := []types.Parameter{
+		{Keyword: "replicas", Type: types.After, ValueType: types.IntValue, Optional: true, Default: float64(3)},
+	}
+	commands := []types.Command{
+		{
+			Keyword: "scale",
+			Params:  params,
+			Subcommands: []types.Command{
+				{Keyword: "down", Params: []types.Parameter{
+					{Keyword: "after", Type: types.After, ValueType: types.DurationValue, Optional: true,
+						Default: "10m"},
+				}},
+			},
+		},
+	}
+	prepared, err := PrepareCommands(commands)
+	if err != nil {
+		t.Fatalf("PrepareCommands returned the error %v", err)
+	}
+	if got := prepared[0].Params[0].Default; got != 3 {
+		t.Errorf("the default of replicas is %#v, want 3", got)
+	}
+	if got := prepared[0].Subcommands[0].Params[0].Default; got != 10*time.Minute {
+		t.Errorf("the default of the subcommand parameter is %#v, want 10m", got)
+	}
+	if got := params[0].Default; got != float64(3) {
+		t.Errorf("PrepareCommands modified the commands of the plugin, the default is %#v", got)
+	}
+
+	commands[0].Subcommands[0].Params[0].Default = "later"
+	if _, err := PrepareCommands(commands); err == nil {
+		t.Error("PrepareCommands accepted an invalid default of a subcommand parameter")
+	}
+}
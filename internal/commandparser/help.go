@@ -0,0 +1,182 @@
+package commandparser
+
+import (
+	"fmt"
+	"github.com/blissfulreboot/slagbot/internal/pluginloader"
+	"github.com/blissfulreboot/slagbot/internal/slackconnection"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"strconv"
+	"strings"
+)
+
+const helpKeyword = "help"
+
+// commandParseError is returned when the message matched a command, but its arguments could not be parsed. The
+// command is carried along so that the reply can show the correct usage.
+type commandParseError struct {
+	command types.Command
+	err     error
+}
+
+func (e *commandParseError) Error() string {
+	return e.err.Error()
+}
+
+func (e *commandParseError) Unwrap() error {
+	return e.err
+}
+
+func valuePlaceholder(param types.Parameter) string {
+	switch param.ValueType {
+	case "", types.StringValue:
+		return "<value>"
+	case types.EnumValue:
+		return fmt.Sprintf("<%s>", strings.Join(param.Choices, "|"))
+	default:
+		return fmt.Sprintf("<%s>", param.ValueType)
+	}
+}
+
+func parameterUsage(param types.Parameter) string {
+	var usage string
+	switch param.Type {
+	case types.Before:
+		usage = fmt.Sprintf("%s %s", valuePlaceholder(param), param.Keyword)
+	case types.After:
+		usage = fmt.Sprintf("%s %s", param.Keyword, valuePlaceholder(param))
+	case types.Positional:
+		usage = fmt.Sprintf("<%s>", param.Keyword)
+	case types.Rest:
+		usage = fmt.Sprintf("<%s...>", param.Keyword)
+	default:
+		usage = param.Keyword
+	}
+	if param.Optional || param.Type == types.Flag {
+		usage = fmt.Sprintf("[%s]", usage)
+	}
+	return usage
+}
+
+// defaultText formats a converted default value the way it would be written in a message
+func defaultText(value interface{}) string {
+	switch v := value.(type) {
+	case types.SlackUser:
+		return fmt.Sprintf("<@%s>", v.ID)
+	case types.SlackChannel:
+		return fmt.Sprintf("<#%s>", v.ID)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func commandUsage(cmd types.Command) string {
+	parts := []string{cmd.Keyword}
+	if len(cmd.Subcommands) > 0 && !hasOwnParams(cmd) {
+		var keywords []string
+		for _, sub := range cmd.Subcommands {
+			keywords = append(keywords, sub.Keyword)
+		}
+		parts = append(parts, fmt.Sprintf("<%s>", strings.Join(keywords, "|")))
+	}
+	for _, param := range cmd.Params {
+		parts = append(parts, parameterUsage(param))
+	}
+	return strings.Join(parts, " ")
+}
+
+func commandHelp(cmd types.Command) string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("*%s*", cmd.Keyword))
+	if cmd.Description != "" {
+		builder.WriteString(fmt.Sprintf(" - %s", cmd.Description))
+	}
+	builder.WriteString(fmt.Sprintf("\nUsage: `%s`", commandUsage(cmd)))
+	if cmd.SlashCommand != "" {
+		builder.WriteString(fmt.Sprintf("\nSlash command: `%s`", cmd.SlashCommand))
+	}
+	for _, param := range cmd.Params {
+		builder.WriteString(fmt.Sprintf("\n• `%s` (%s)", parameterUsage(param), param.Type))
+		if param.Description != "" {
+			builder.WriteString(fmt.Sprintf(": %s", param.Description))
+		}
+		if param.Default != nil {
+			builder.WriteString(fmt.Sprintf(" (default: %s)", defaultText(param.Default)))
+		}
+	}
+	if len(cmd.Subcommands) > 0 {
+		builder.WriteString("\nSubcommands:")
+		for _, sub := range cmd.Subcommands {
+			builder.WriteString(fmt.Sprintf("\n• `%s %s`", cmd.Keyword, sub.Keyword))
+			if sub.Description != "" {
+				builder.WriteString(fmt.Sprintf(" - %s", sub.Description))
+			}
+		}
+	}
+	return builder.String()
+}
+
+func commandList(plugins []*pluginloader.ReadyPlugin) string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("Available commands. Use `%s <command>` for details.", helpKeyword))
+	for _, plug := range plugins {
+		if len(plug.Commands) == 0 {
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("\n\n*%s*", plug.File))
+		for _, cmd := range plug.AllCommands() {
+			builder.WriteString(fmt.Sprintf("\n• `%s`", cmd.Keyword))
+			if cmd.Description != "" {
+				builder.WriteString(fmt.Sprintf(" - %s", cmd.Description))
+			}
+		}
+	}
+	return builder.String()
+}
+
+// helpTopic checks if the message is a help request. The topic is the text after the help keyword, empty if the
+// whole command list was requested. Mentions in front of the keyword are ignored.
+func helpTopic(text string) (string, bool) {
+	words := strings.Fields(text)
+	for len(words) > 0 && strings.HasPrefix(words[0], "<@") {
+		words = words[1:]
+	}
+	if len(words) == 0 || words[0] != helpKeyword {
+		return "", false
+	}
+	return strings.Join(words[1:], " "), true
+}
+
+// helpReply returns the help of the topic, which can be the keyword of a command or the name of a plugin, or the list
+// of all commands if the topic is empty. The second return value tells if the topic was found.
+func helpReply(topic string, plugins []*pluginloader.ReadyPlugin) (string, bool) {
+	if topic == "" {
+		return commandList(plugins), false
+	}
+	for _, plug := range plugins {
+		for _, cmd := range plug.AllCommands() {
+			if cmd.Keyword == topic {
+				return commandHelp(cmd), true
+			}
+		}
+	}
+	for _, plug := range plugins {
+		if plug.File == topic {
+			return commandList([]*pluginloader.ReadyPlugin{plug}), true
+		}
+	}
+	return fmt.Sprintf("Unknown command `%s`. Use `%s` to list the available commands.", topic, helpKeyword), false
+}
+
+// handleHelp answers the help request. "help" is a common word in chat, so a request that was not addressed to the
+// bot is answered only if its topic is a known command or plugin.
+func (ch *CommandHandler) handleHelp(message slackconnection.SlackMessage, topic string, addressed bool,
+	plugins []*pluginloader.ReadyPlugin) {
+	reply, found := helpReply(topic, plugins)
+	if !found && !addressed {
+		ch.logger.Debugf("Ignoring a help request that was not addressed to the bot: %+v", message)
+		return
+	}
+	ch.reply(message, reply)
+}
@@ -0,0 +1,86 @@
+package commandparser
+
+import (
+	"github.com/blissfulreboot/slagbot/internal/pluginloader"
+	"github.com/blissfulreboot/slagbot/internal/slackconnection"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"go.uber.org/zap"
+	"strings"
+	"testing"
+)
+
+func newTestHandler() *CommandHandler {
+	return &CommandHandler{
+		outgoingMsgChannel: make(chan types.OutgoingSlackMessage, 10),
+		logger:             zap.NewNop().Sugar(),
+	}
+}
+
+func testPlugins() []*pluginloader.ReadyPlugin {
+	return []*pluginloader.ReadyPlugin{
+		{
+			File: "deploy.plugin",
+			Commands: []types.Command{
+				{Keyword: "deploy", Description: "Deploys the app"},
+				{Keyword: "rollback", Description: "Rolls back the app"},
+			},
+		},
+	}
+}
+
+// replies returns the texts of the messages the handler has sent
+func replies(ch *CommandHandler) []string {
+	var texts []string
+	for {
+		select {
+		case msg := <-ch.outgoingMsgChannel:
+			texts = append(texts, msg.Message)
+		default:
+			return texts
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	tests := []struct {
+		text      string
+		addressed bool
+		// reply is a part of the expected reply, empty if the bot should stay silent
+		reply string
+	}{
+		{text: "help", addressed: true, reply: "Available commands"},
+		{text: "help", addressed: false},
+		{text: "help deploy", addressed: true, reply: "Deploys the app"},
+		{text: "help deploy", addressed: false, reply: "Deploys the app"},
+		{text: "help deploy.plugin", addressed: false, reply: "Rolls back the app"},
+		{text: "help me with the build", addressed: true, reply: "Unknown command `me with the build`"},
+		{text: "help me with the build", addressed: false},
+	}
+	for _, test := range tests {
+		ch := newTestHandler()
+		message := slackconnection.SlackMessage{Text: test.text, Channel: "C1"}
+		if err := ch.dispatchMessage(message, test.addressed, testPlugins()); err != nil {
+			t.Errorf("dispatchMessage(%q, %t) returned the error %v", test.text, test.addressed, err)
+			continue
+		}
+		got := replies(ch)
+		if test.reply == "" {
+			if len(got) > 0 {
+				t.Errorf("dispatchMessage(%q, %t) replied %q, want no reply", test.text, test.addressed, got)
+			}
+			continue
+		}
+		if len(got) != 1 || !strings.Contains(got[0], test.reply) {
+			t.Errorf("dispatchMessage(%q, %t) replied %q, want %q", test.text, test.addressed, got, test.reply)
+		}
+	}
+}
+
+func TestCommandHelpShowsDefaults(t *testing.T) {
+	help := commandHelp(testDeployCommand(t))
+	for _, want := range []string{"(default: dev)", "(default: 1000000)"} {
+		if !strings.Contains(help, want) {
+			t.Errorf("commandHelp() = %q, want it to contain %q", help, want)
+		}
+	}
+}
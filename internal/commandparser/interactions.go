@@ -0,0 +1,82 @@
+package commandparser
+
+import (
+	"errors"
+	"fmt"
+	"github.com/blissfulreboot/slagbot/internal/authorization"
+	"github.com/blissfulreboot/slagbot/internal/pluginloader"
+	"github.com/blissfulreboot/slagbot/internal/slackconnection"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+)
+
+// findInteractionOwner returns the plugin that registered the longest prefix of the interaction's id.
+func findInteractionOwner(id string, plugins []*pluginloader.ReadyPlugin) *pluginloader.ReadyPlugin {
+	var owner *pluginloader.ReadyPlugin
+	longest := -1
+	for _, plug := range plugins {
+		prefix, found := plug.InteractionPrefix(id)
+		if found && len(prefix) > longest {
+			owner = plug
+			longest = len(prefix)
+		}
+	}
+	return owner
+}
+
+func (ch *CommandHandler) dispatchInteraction(interaction slackconnection.SlackInteraction,
+	plugins []*pluginloader.ReadyPlugin) error {
+	id := interaction.Interaction.ID()
+	plug := findInteractionOwner(id, plugins)
+	if plug == nil {
+		ch.logger.Warnf("No plugin has registered the interaction id %s", id)
+		return nil
+	}
+	ch.logger.Debugf("Interaction %s is handled by plugin %s", id, plug.File)
+
+	// The buttons of a message can be clicked by anyone who sees the message, so the user is checked like for a command
+	if authErr := ch.authorizer.AuthorizeInteraction(interaction.User, interaction.Channel, plug.File); authErr != nil {
+		ch.logger.Warnf("User %s was denied the interaction %s of plugin %s in channel %s: %s", interaction.User, id,
+			plug.File, interaction.Channel, authErr)
+		if interaction.Channel != "" {
+			reply := "Sorry, you are not allowed to do that"
+			var deniedErr *authorization.AccessDeniedError
+			if errors.As(authErr, &deniedErr) {
+				reply = fmt.Sprintf("%s: %s", reply, deniedErr.Reason)
+			}
+			ch.outgoingMsgChannel <- types.OutgoingSlackMessage{
+				Channel:         interaction.Channel,
+				User:            interaction.User,
+				Operation:       types.PostEphemeral,
+				Message:         reply,
+				ThreadTimestamp: interaction.ThreadTimestamp,
+			}
+		}
+		return nil
+	}
+
+	parsedInteraction := interaction.Interaction
+	return plug.Deliver(types.ParsedCommand{
+		Channel:          interaction.Channel,
+		User:             types.NewUser(interaction.User, ch.userLookup),
+		MessageTimestamp: interaction.MessageTimestamp,
+		ThreadTimestamp:  interaction.ThreadTimestamp,
+		Interaction:      &parsedInteraction,
+	})
+}
+
+func (ch *CommandHandler) handleInteraction(interaction slackconnection.SlackInteraction) {
+	err := ch.plugins.WithPlugins(func(plugins []*pluginloader.ReadyPlugin) error {
+		return ch.dispatchInteraction(interaction, plugins)
+	})
+	if err != nil {
+		ch.logger.Errorf("Could not deliver the interaction %s", interaction.Interaction.ID())
+		ch.logger.Debug(err)
+		if interaction.Channel != "" {
+			ch.outgoingMsgChannel <- types.OutgoingSlackMessage{
+				Channel:         interaction.Channel,
+				Message:         "Sorry, that action is temporarily unavailable. Please try again later.",
+				ThreadTimestamp: interaction.ThreadTimestamp,
+			}
+		}
+	}
+}
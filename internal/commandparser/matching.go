@@ -0,0 +1,105 @@
+package commandparser
+
+import (
+	"fmt"
+	"github.com/blissfulreboot/slagbot/internal/pluginloader"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"strings"
+)
+
+type commandMatch struct {
+	plugin  *pluginloader.ReadyPlugin
+	command types.Command
+	length  int
+	// qualified is true when the keyword is preceded by the name of the plugin, e.g. "a.plugin deploy"
+	qualified bool
+}
+
+// String returns the keyword qualified with the name of the plugin, which selects the command when the keyword is
+// defined by several plugins.
+func (m commandMatch) String() string {
+	return fmt.Sprintf("`%s %s`", m.plugin.File, m.command.Keyword)
+}
+
+// ambiguousCommandError is returned when the longest matching keyword belongs to more than one command.
+type ambiguousCommandError struct {
+	matches []commandMatch
+	// slashCommand is set when the ambiguous command was a slash command, which is qualified after the command
+	slashCommand string
+}
+
+// suggestion lists the candidates, e.g. "`a.plugin deploy` or `b.plugin deploy`", or "`/deploy a.plugin` or
+// `/deploy b.plugin`" for a slash command.
+func (e *ambiguousCommandError) suggestion() string {
+	var candidates []string
+	for _, match := range e.matches {
+		if e.slashCommand != "" {
+			candidates = append(candidates, fmt.Sprintf("`%s %s`", e.slashCommand, match.plugin.File))
+			continue
+		}
+		candidates = append(candidates, match.String())
+	}
+	last := len(candidates) - 1
+	if last == 0 {
+		return candidates[0]
+	}
+	return fmt.Sprintf("%s or %s", strings.Join(candidates[:last], ", "), candidates[last])
+}
+
+func (e *ambiguousCommandError) Error() string {
+	return fmt.Sprintf("ambiguous command, did you mean %s?", e.suggestion())
+}
+
+// keywordLength is the length of the keyword with the whitespace normalized.
+func keywordLength(keyword string) int {
+	return len(strings.Join(strings.Fields(keyword), " "))
+}
+
+// matchCommand finds the command whose keyword is found in the tokens as whole words. When several keywords are
+// found, the longest wins regardless of the plugin order. If the longest keyword belongs to several commands, the one
+// whose keyword is preceded by the name of its plugin wins. Nil match without an error means that no command matched.
+func matchCommand(tokens []token, plugins []*pluginloader.ReadyPlugin) (*commandMatch, error) {
+	return matchCommandIn(tokens, plugins, (*pluginloader.ReadyPlugin).AllCommands)
+}
+
+// matchCommandIn works like matchCommand, but only considers the commands returned by the commands function.
+func matchCommandIn(tokens []token, plugins []*pluginloader.ReadyPlugin,
+	commands func(plug *pluginloader.ReadyPlugin) []types.Command) (*commandMatch, error) {
+	var best []commandMatch
+	for _, plug := range plugins {
+		for _, cmd := range commands(plug) {
+			index := findKeyword(tokens, cmd.Keyword)
+			if index == -1 {
+				continue
+			}
+			match := commandMatch{
+				plugin:    plug,
+				command:   cmd,
+				length:    keywordLength(cmd.Keyword),
+				qualified: index > 0 && tokens[index-1].kind == wordToken && tokens[index-1].value == plug.File,
+			}
+			switch {
+			case len(best) == 0 || match.length > best[0].length:
+				best = []commandMatch{match}
+			case match.length == best[0].length:
+				best = append(best, match)
+			}
+		}
+	}
+	if len(best) == 0 {
+		return nil, nil
+	}
+	if len(best) > 1 {
+		var qualified []commandMatch
+		for _, match := range best {
+			if match.qualified {
+				qualified = append(qualified, match)
+			}
+		}
+		if len(qualified) != 1 {
+			return nil, &ambiguousCommandError{matches: best}
+		}
+		return &qualified[0], nil
+	}
+	return &best[0], nil
+}
@@ -0,0 +1,60 @@
+package commandparser
+
+import (
+	"errors"
+	"github.com/blissfulreboot/slagbot/internal/pluginloader"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"testing"
+)
+
+func TestMatchCommand(t *testing.T) {
+	plugins := []*pluginloader.ReadyPlugin{
+		{
+			File:     "a.plugin",
+			Commands: []types.Command{{Keyword: "deploy"}, {Keyword: "deploy status"}},
+		},
+		{
+			File:     "b.plugin",
+			Commands: []types.Command{{Keyword: "deploy"}, {Keyword: "rollback"}},
+		},
+	}
+	tests := []struct {
+		text string
+		// file and keyword of the expected command, both empty if no command should match
+		file    string
+		keyword string
+		// ambiguous is the expected suggestion if the match should be ambiguous
+		ambiguous string
+	}{
+		{text: "rollback now", file: "b.plugin", keyword: "rollback"},
+		{text: "deploy status of app", file: "a.plugin", keyword: "deploy status"},
+		{text: "a.plugin deploy app", file: "a.plugin", keyword: "deploy"},
+		{text: "please b.plugin deploy", file: "b.plugin", keyword: "deploy"},
+		{text: "deploy app", ambiguous: "`a.plugin deploy` or `b.plugin deploy`"},
+		{text: "c.plugin deploy app", ambiguous: "`a.plugin deploy` or `b.plugin deploy`"},
+		{text: "redeploy app"},
+	}
+	for _, test := range tests {
+		match, err := matchCommand(tokenize(test.text), plugins)
+		if test.ambiguous != "" {
+			var ambiguousErr *ambiguousCommandError
+			if !errors.As(err, &ambiguousErr) || ambiguousErr.suggestion() != test.ambiguous {
+				t.Errorf("matchCommand(%q) = %v, %v, want ambiguous %s", test.text, match, err, test.ambiguous)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("matchCommand(%q) returned the error %v", test.text, err)
+			continue
+		}
+		if test.file == "" {
+			if match != nil {
+				t.Errorf("matchCommand(%q) = %v, want no match", test.text, match)
+			}
+			continue
+		}
+		if match == nil || match.plugin.File != test.file || match.command.Keyword != test.keyword {
+			t.Errorf("matchCommand(%q) = %v, want %s of %s", test.text, match, test.keyword, test.file)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package commandparser
+
+import (
+	"fmt"
+	"github.com/blissfulreboot/slagbot/internal/pluginloader"
+	"github.com/blissfulreboot/slagbot/internal/slackconnection"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"strings"
+)
+
+// findSlashCommand returns the commands that are exposed as the slash command.
+func findSlashCommand(slashCommand string, plugins []*pluginloader.ReadyPlugin) []commandMatch {
+	var matches []commandMatch
+	for _, plug := range plugins {
+		for _, cmd := range plug.AllCommands() {
+			if cmd.SlashCommand == slashCommand {
+				matches = append(matches, commandMatch{plugin: plug, command: cmd})
+			}
+		}
+	}
+	return matches
+}
+
+// selectSlashOwner returns the command that the slash command runs and the text without the name of the plugin. When
+// several plugins expose the slash command, the name of the plugin is written first to select the command, e.g.
+// "/deploy a.plugin app", like the name of the plugin before the keyword selects the command in a message. Nil is
+// returned if the command could not be selected.
+func selectSlashOwner(text string, owners []commandMatch) (*commandMatch, string) {
+	words := strings.Fields(text)
+	if len(words) > 0 {
+		for i := range owners {
+			if owners[i].plugin.File == words[0] {
+				return &owners[i], strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), words[0]))
+			}
+		}
+	}
+	if len(owners) == 1 {
+		return &owners[0], text
+	}
+	return nil, text
+}
+
+// dispatchSlashCommand runs the command exposed as the slash command. The text of the slash command is parsed as if
+// it was written after the keyword of the command, so that the subcommands and the parameters work the same way.
+func (ch *CommandHandler) dispatchSlashCommand(message slackconnection.SlackMessage,
+	plugins []*pluginloader.ReadyPlugin) error {
+	owners := findSlashCommand(message.SlashCommand, plugins)
+	if len(owners) == 0 {
+		ch.logger.Warnf("No plugin has defined the slash command %s", message.SlashCommand)
+		ch.reply(message, fmt.Sprintf("Sorry, `%s` is not available right now.", message.SlashCommand))
+		return nil
+	}
+	owner, text := selectSlashOwner(message.Text, owners)
+	if owner == nil {
+		return &ambiguousCommandError{matches: owners, slashCommand: message.SlashCommand}
+	}
+	message.Text = text
+
+	if topic, isHelp := helpTopic(message.Text); isHelp && topic == "" {
+		ch.reply(message, commandHelp(owner.command))
+		return nil
+	}
+
+	message.Text = strings.TrimSpace(owner.command.Keyword + " " + message.Text)
+	match, matchErr := matchCommandIn(tokenize(message.Text), []*pluginloader.ReadyPlugin{owner.plugin},
+		func(plug *pluginloader.ReadyPlugin) []types.Command {
+			return owner.command.Flatten()
+		})
+	if matchErr != nil {
+		return matchErr
+	}
+	if match == nil {
+		// The keyword was added to the text, so this should not happen
+		return &unknownCommandError{}
+	}
+	return ch.runCommand(message, match)
+}
@@ -0,0 +1,79 @@
+package commandparser
+
+import (
+	"errors"
+	"github.com/blissfulreboot/slagbot/internal/authorization"
+	"github.com/blissfulreboot/slagbot/internal/pluginloader"
+	"github.com/blissfulreboot/slagbot/internal/slackconnection"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"go.uber.org/zap"
+	"testing"
+)
+
+// slashPlugins returns two plugins that both expose their deploy command as /deploy
+func slashPlugins() []*pluginloader.ReadyPlugin {
+	var plugins []*pluginloader.ReadyPlugin
+	for _, file := range []string{"a.plugin", "b.plugin"} {
+		plugins = append(plugins, &pluginloader.ReadyPlugin{
+			File: file,
+			Commands: []types.Command{{
+				Keyword:      "deploy",
+				SlashCommand: "/deploy",
+				Params:       []types.Parameter{{Keyword: "service", Type: types.Positional}},
+			}},
+		})
+	}
+	return plugins
+}
+
+func TestSelectSlashOwner(t *testing.T) {
+	plugins := slashPlugins()
+	owners := findSlashCommand("/deploy", plugins)
+	tests := []struct {
+		text     string
+		owners   []commandMatch
+		wantFile string
+		wantText string
+	}{
+		{text: "b.plugin app", owners: owners, wantFile: "b.plugin", wantText: "app"},
+		{text: " a.plugin  app now", owners: owners, wantFile: "a.plugin", wantText: "app now"},
+		{text: "app", owners: owners},
+		{text: "", owners: owners},
+		{text: "app", owners: owners[:1], wantFile: "a.plugin", wantText: "app"},
+		{text: "a.plugin app", owners: owners[:1], wantFile: "a.plugin", wantText: "app"},
+	}
+	for _, test := range tests {
+		owner, text := selectSlashOwner(test.text, test.owners)
+		if test.wantFile == "" {
+			if owner != nil {
+				t.Errorf("selectSlashOwner(%q) selected %s, want none", test.text, owner.plugin.File)
+			}
+			continue
+		}
+		if owner == nil || owner.plugin.File != test.wantFile || text != test.wantText {
+			t.Errorf("selectSlashOwner(%q) = %v, %q, want %s, %q", test.text, owner, text, test.wantFile,
+				test.wantText)
+		}
+	}
+}
+
+func TestAmbiguousSlashCommand(t *testing.T) {
+	ch := newTestHandler()
+	ch.authorizer = authorization.NewAuthorizer(nil, nil, nil, nil, zap.NewNop().Sugar())
+	message := slackconnection.SlackMessage{SlashCommand: "/deploy", Text: "app", Channel: "C1", User: "U1"}
+
+	err := ch.dispatchSlashCommand(message, slashPlugins())
+	var ambiguousErr *ambiguousCommandError
+	if !errors.As(err, &ambiguousErr) {
+		t.Fatalf("dispatchSlashCommand returned %v, want an ambiguous command error", err)
+	}
+	want := "`/deploy a.plugin` or `/deploy b.plugin`"
+	if got := ambiguousErr.suggestion(); got != want {
+		t.Errorf("the suggestion is %q, want %q", got, want)
+	}
+
+	message.Text = "b.plugin app"
+	if err := ch.dispatchSlashCommand(message, slashPlugins()); errors.As(err, &ambiguousErr) {
+		t.Errorf("dispatchSlashCommand(%q) returned %v, want the command of b.plugin to run", message.Text, err)
+	}
+}
@@ -0,0 +1,121 @@
+package commandparser
+
+import (
+	"fmt"
+	"github.com/blissfulreboot/slagbot/internal/pluginloader"
+	"strings"
+)
+
+const maxSuggestions = 3
+
+// unknownCommandError is returned when the message did not match any command. It carries the keywords that are
+// close to the words of the message.
+type unknownCommandError struct {
+	suggestions []string
+}
+
+func (e *unknownCommandError) Error() string {
+	return "no command found"
+}
+
+func (e *unknownCommandError) reply() string {
+	if len(e.suggestions) == 0 {
+		return fmt.Sprintf("Sorry, I did not understand that. Use `%s` to list the available commands.", helpKeyword)
+	}
+	quoted := make([]string, len(e.suggestions))
+	for i, suggestion := range e.suggestions {
+		quoted[i] = fmt.Sprintf("`%s`", suggestion)
+	}
+	last := len(quoted) - 1
+	if last == 0 {
+		return fmt.Sprintf("Did you mean %s?", quoted[0])
+	}
+	return fmt.Sprintf("Did you mean %s or %s?", strings.Join(quoted[:last], ", "), quoted[last])
+}
+
+// editDistance is the optimal string alignment distance, i.e. the Levenshtein distance where swapping two adjacent
+// characters counts as a single edit.
+func editDistance(a string, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, minInt(d[i][j-1]+1, d[i-1][j-1]+cost))
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// maxTypoDistance is the largest edit distance that is still considered a typo of the keyword.
+func maxTypoDistance(keyword string) int {
+	if len(keyword) < 8 {
+		return 1
+	}
+	return len(keyword) / 4
+}
+
+// suggestCommands returns the keywords closest to the words of the message, or nil if none is close enough. The
+// keyword is compared with every sequence of the same number of words in the message.
+func suggestCommands(tokens []token, plugins []*pluginloader.ReadyPlugin) []string {
+	var words []string
+	for _, tok := range tokens {
+		if tok.kind == wordToken {
+			words = append(words, strings.ToLower(tok.value))
+		}
+	}
+
+	keywords := []string{helpKeyword}
+	for _, plug := range plugins {
+		for _, cmd := range plug.AllCommands() {
+			keywords = append(keywords, strings.Join(strings.Fields(cmd.Keyword), " "))
+		}
+	}
+
+	var suggestions []string
+	best := -1
+	seen := make(map[string]bool)
+	for _, keyword := range keywords {
+		if seen[keyword] {
+			continue
+		}
+		seen[keyword] = true
+		keywordWords := len(strings.Fields(keyword))
+		for start := 0; start+keywordWords <= len(words); start++ {
+			candidate := strings.Join(words[start:start+keywordWords], " ")
+			distance := editDistance(candidate, strings.ToLower(keyword))
+			if distance > maxTypoDistance(keyword) {
+				continue
+			}
+			switch {
+			case best == -1 || distance < best:
+				best = distance
+				suggestions = []string{keyword}
+			case distance == best && len(suggestions) < maxSuggestions && suggestions[len(suggestions)-1] != keyword:
+				suggestions = append(suggestions, keyword)
+			}
+		}
+	}
+	return suggestions
+}
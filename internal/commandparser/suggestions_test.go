@@ -0,0 +1,67 @@
+package commandparser
+
+import (
+	"github.com/blissfulreboot/slagbot/internal/pluginloader"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"reflect"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{a: "", b: "", want: 0},
+		{a: "deploy", b: "deploy", want: 0},
+		{a: "", b: "help", want: 4},
+		{a: "deplyo", b: "deploy", want: 1},
+		{a: "delpoy", b: "deploy", want: 1},
+		{a: "deploy", b: "deplo", want: 1},
+		{a: "deploy", b: "deploys", want: 1},
+		{a: "deploy", b: "depl0y", want: 1},
+		{a: "kitten", b: "sitting", want: 3},
+		{a: "ca", b: "abc", want: 3},
+		{a: "päivä", b: "paiva", want: 2},
+	}
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b); got != test.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestSuggestCommands(t *testing.T) {
+	plugins := []*pluginloader.ReadyPlugin{
+		{
+			File: "deploy.plugin",
+			Commands: []types.Command{
+				{Keyword: "deploy"},
+				{Keyword: "status", Subcommands: []types.Command{{Keyword: "history"}}},
+			},
+		},
+		{
+			File:     "ops.plugin",
+			Commands: []types.Command{{Keyword: "rotate secrets"}, {Keyword: "deploy"}},
+		},
+	}
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "deplyo app", want: []string{"deploy"}},
+		{text: "please DEPLOI", want: []string{"deploy"}},
+		{text: "hlep", want: []string{helpKeyword}},
+		{text: "rotate secret", want: []string{"rotate secrets"}},
+		{text: "stats", want: []string{"status"}},
+		{text: "dpleoy", want: nil},
+		{text: "something else", want: nil},
+		{text: `"deplyo"`, want: nil},
+	}
+	for _, test := range tests {
+		if got := suggestCommands(tokenize(test.text), plugins); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("suggestCommands(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package commandparser
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	wordToken tokenKind = iota
+	quotedToken
+	markupToken
+)
+
+// token is a single word, quoted string or Slack markup element of a message. Value is the clean value with the
+// markup and HTML escaping removed, e.g. "U123" for <@U123|john> and "a@b.com" for <mailto:a@b.com|a@b.com>.
+type token struct {
+	kind   tokenKind
+	value  string
+	target string
+	label  string
+	// raw is the token as it was written. Markup is kept as is, so that mentions still work if the text is posted back
+	// to Slack.
+	raw string
+	// start and end are the positions of the token in the message, in runes
+	start int
+	end   int
+}
+
+var closingQuotes = map[rune]rune{
+	'"':  '"',
+	'\'': '\'',
+	'“':  '”', // Slack may convert straight quotes to smart quotes
+	'‘':  '’',
+}
+
+// markupValue returns the underlying value of the target of a Slack markup element.
+func markupValue(target string) string {
+	switch {
+	case strings.HasPrefix(target, "@"), strings.HasPrefix(target, "#"):
+		return target[1:]
+	case strings.HasPrefix(target, "mailto:"):
+		return strings.TrimPrefix(target, "mailto:")
+	case strings.HasPrefix(target, "!subteam^"):
+		return strings.TrimPrefix(target, "!subteam^")
+	case strings.HasPrefix(target, "!"):
+		return target[1:]
+	default:
+		return target
+	}
+}
+
+// tokenize splits the text of a Slack message to tokens. Slack escapes &, < and > in the text, so all literal < and
+// > characters start and end a markup element like <@U123>, <#C123|general> or <https://example.com|Example>.
+func tokenize(text string) []token {
+	var tokens []token
+	runes := []rune(text)
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '<':
+			end := indexRune(runes, '>', i+1)
+			if end == -1 {
+				end = len(runes)
+			}
+			target, label, _ := strings.Cut(string(runes[i+1:end]), "|")
+			target = html.UnescapeString(target)
+			rawEnd := end + 1
+			if rawEnd > len(runes) {
+				rawEnd = len(runes)
+			}
+			tokens = append(tokens, token{
+				kind:   markupToken,
+				value:  markupValue(target),
+				target: target,
+				label:  html.UnescapeString(label),
+				raw:    string(runes[i:rawEnd]),
+				start:  i,
+				end:    rawEnd,
+			})
+			i = end + 1
+
+		case closingQuotes[r] != 0 && closingQuoteIndex(runes, closingQuotes[r], i+1) != -1:
+			end := closingQuoteIndex(runes, closingQuotes[r], i+1)
+			tokens = append(tokens, token{
+				kind:  quotedToken,
+				value: html.UnescapeString(string(runes[i+1 : end])),
+				raw:   html.UnescapeString(string(runes[i : end+1])),
+				start: i,
+				end:   end + 1,
+			})
+			i = end + 1
+
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '<' {
+				end++
+			}
+			value := html.UnescapeString(string(runes[i:end]))
+			tokens = append(tokens, token{
+				kind:  wordToken,
+				value: value,
+				raw:   value,
+				start: i,
+				end:   end,
+			})
+			i = end
+		}
+	}
+	return tokens
+}
+
+// closingQuoteIndex returns the index of the first closing quote that ends a word, or -1 if there is none. This way
+// an apostrophe inside a word, like in "it's", does not close a quote, and a word starting with an apostrophe, like
+// "'cause", is not taken as the start of a quoted string.
+func closingQuoteIndex(runes []rune, quote rune, start int) int {
+	for i := start; i < len(runes); i++ {
+		if runes[i] != quote {
+			continue
+		}
+		if i+1 == len(runes) || unicode.IsSpace(runes[i+1]) || runes[i+1] == '<' {
+			return i
+		}
+	}
+	return -1
+}
+
+func indexRune(runes []rune, r rune, start int) int {
+	for i := start; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// findKeyword returns the index of the first token of the keyword in the tokens, or -1 if the keyword is not found.
+// The keyword must match whole words, and quoted strings and markup never match.
+func findKeyword(tokens []token, keyword string) int {
+	words := strings.Fields(keyword)
+	if len(words) == 0 {
+		return -1
+	}
+	for start := 0; start+len(words) <= len(tokens); start++ {
+		matches := true
+		for j, word := range words {
+			if tokens[start+j].kind != wordToken || tokens[start+j].value != word {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return start
+		}
+	}
+	return -1
+}
+
+// joinTokens joins the raw values of the tokens of the text. The whitespace between adjacent tokens is kept as it was
+// written, including newlines, and tokens that had other tokens between them are separated by a space.
+func joinTokens(text string, tokens []token) string {
+	runes := []rune(text)
+	var joined strings.Builder
+	for i, tok := range tokens {
+		if i > 0 {
+			separator := string(runes[tokens[i-1].end:tok.start])
+			if strings.TrimSpace(separator) != "" {
+				separator = " "
+			}
+			joined.WriteString(separator)
+		}
+		joined.WriteString(tok.raw)
+	}
+	return joined.String()
+}
@@ -0,0 +1,154 @@
+package commandparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []token
+	}{
+		{
+			name: "words",
+			text: "deploy  app\tnow",
+			want: []token{
+				{kind: wordToken, value: "deploy", raw: "deploy", start: 0, end: 6},
+				{kind: wordToken, value: "app", raw: "app", start: 8, end: 11},
+				{kind: wordToken, value: "now", raw: "now", start: 12, end: 15},
+			},
+		},
+		{
+			name: "double quotes",
+			text: `say "hello world"`,
+			want: []token{
+				{kind: wordToken, value: "say", raw: "say", start: 0, end: 3},
+				{kind: quotedToken, value: "hello world", raw: `"hello world"`, start: 4, end: 17},
+			},
+		},
+		{
+			name: "smart quotes",
+			text: "say “hello world”",
+			want: []token{
+				{kind: wordToken, value: "say", raw: "say", start: 0, end: 3},
+				{kind: quotedToken, value: "hello world", raw: "“hello world”", start: 4, end: 17},
+			},
+		},
+		{
+			name: "single quotes",
+			text: "say 'hello world' now",
+			want: []token{
+				{kind: wordToken, value: "say", raw: "say", start: 0, end: 3},
+				{kind: quotedToken, value: "hello world", raw: "'hello world'", start: 4, end: 17},
+				{kind: wordToken, value: "now", raw: "now", start: 18, end: 21},
+			},
+		},
+		{
+			name: "apostrophes",
+			text: "'cause it's fine",
+			want: []token{
+				{kind: wordToken, value: "'cause", raw: "'cause", start: 0, end: 6},
+				{kind: wordToken, value: "it's", raw: "it's", start: 7, end: 11},
+				{kind: wordToken, value: "fine", raw: "fine", start: 12, end: 16},
+			},
+		},
+		{
+			name: "unclosed quote",
+			text: `say "hello world`,
+			want: []token{
+				{kind: wordToken, value: "say", raw: "say", start: 0, end: 3},
+				{kind: wordToken, value: `"hello`, raw: `"hello`, start: 4, end: 10},
+				{kind: wordToken, value: "world", raw: "world", start: 11, end: 16},
+			},
+		},
+		{
+			name: "user mention",
+			text: "greet <@U123|john>",
+			want: []token{
+				{kind: wordToken, value: "greet", raw: "greet", start: 0, end: 5},
+				{kind: markupToken, value: "U123", target: "@U123", label: "john",
+					raw: "<@U123|john>", start: 6, end: 18},
+			},
+		},
+		{
+			name: "email and escaped text",
+			text: "mail <mailto:a@b.com|a@b.com> a&amp;b",
+			want: []token{
+				{kind: wordToken, value: "mail", raw: "mail", start: 0, end: 4},
+				{kind: markupToken, value: "a@b.com", target: "mailto:a@b.com", label: "a@b.com",
+					raw: "<mailto:a@b.com|a@b.com>", start: 5, end: 29},
+				{kind: wordToken, value: "a&b", raw: "a&b", start: 30, end: 37},
+			},
+		},
+		{
+			name: "markup without space",
+			text: "ping<#C123|general>",
+			want: []token{
+				{kind: wordToken, value: "ping", raw: "ping", start: 0, end: 4},
+				{kind: markupToken, value: "C123", target: "#C123", label: "general",
+					raw: "<#C123|general>", start: 4, end: 19},
+			},
+		},
+		{
+			name: "empty",
+			text: "  ",
+			want: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := tokenize(test.text)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("tokenize(%q) = %+v, want %+v", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFindKeyword(t *testing.T) {
+	tests := []struct {
+		text    string
+		keyword string
+		want    int
+	}{
+		{text: "deploy app", keyword: "deploy", want: 0},
+		{text: "please deploy app", keyword: "deploy app", want: 1},
+		{text: "deployment app", keyword: "deploy", want: -1},
+		{text: `"deploy" app`, keyword: "deploy", want: -1},
+		{text: "deploy", keyword: "deploy app", want: -1},
+		{text: "deploy app", keyword: "  ", want: -1},
+	}
+	for _, test := range tests {
+		if got := findKeyword(tokenize(test.text), test.keyword); got != test.want {
+			t.Errorf("findKeyword(%q, %q) = %d, want %d", test.text, test.keyword, got, test.want)
+		}
+	}
+}
+
+func TestJoinTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		skip int
+		want string
+	}{
+		{text: "note first line\n  second line", skip: 1, want: "first line\n  second line"},
+		{text: "note <@U123|john>  &amp; \"me\"", skip: 1, want: "<@U123|john>  & \"me\""},
+		{text: "note ping<#C123>", skip: 1, want: "ping<#C123>"},
+		{text: "note", skip: 1, want: ""},
+	}
+	for _, test := range tests {
+		tokens := tokenize(test.text)
+		if got := joinTokens(test.text, tokens[test.skip:]); got != test.want {
+			t.Errorf("joinTokens(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+
+	// A token removed from the middle is replaced by a single space
+	text := "a  b\n c"
+	tokens := tokenize(text)
+	if got := joinTokens(text, []token{tokens[0], tokens[2]}); got != "a c" {
+		t.Errorf("joinTokens without the middle token = %q, want %q", got, "a c")
+	}
+}
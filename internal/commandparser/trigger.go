@@ -0,0 +1,58 @@
+package commandparser
+
+import (
+	"github.com/blissfulreboot/slagbot/internal/slackconnection"
+	"strings"
+)
+
+const (
+	TriggerAny     = "any"
+	TriggerMention = "mention"
+	TriggerPrefix  = "prefix"
+)
+
+// TriggerPolicy decides which messages are treated as commands. Mode is one of TriggerAny, TriggerMention and
+// TriggerPrefix, and ChannelModes overrides it per channel ID. Direct messages are always accepted if
+// AcceptDirectMessages is set.
+type TriggerPolicy struct {
+	Mode                 string
+	Prefix               string
+	AcceptDirectMessages bool
+	ChannelModes         map[string]string
+}
+
+// commandText returns the part of the message that should be parsed as a command, and false if the message did not
+// trigger the bot. The last return value tells if the message was clearly addressed to the bot, i.e. it was a direct
+// message, a slash command, mentioned the bot or started with the prefix.
+func (p TriggerPolicy) commandText(message slackconnection.SlackMessage) (string, bool, bool) {
+	text := strings.TrimSpace(message.Text)
+	if message.SlashCommand != "" {
+		return text, true, true
+	}
+	if message.DirectMessage && p.AcceptDirectMessages {
+		return strings.TrimPrefix(text, p.Prefix), true, true
+	}
+
+	mode, hasOverride := p.ChannelModes[message.Channel]
+	if !hasOverride {
+		mode = p.Mode
+	}
+
+	hasPrefix := p.Prefix != "" && strings.HasPrefix(text, p.Prefix)
+	switch mode {
+	case TriggerAny:
+		if hasPrefix {
+			return strings.TrimSpace(strings.TrimPrefix(text, p.Prefix)), true, true
+		}
+		return text, true, message.Mentioned
+	case TriggerMention:
+		return text, message.Mentioned, message.Mentioned
+	case TriggerPrefix:
+		if !hasPrefix {
+			return "", false, false
+		}
+		return strings.TrimSpace(strings.TrimPrefix(text, p.Prefix)), true, true
+	default:
+		return "", false, false
+	}
+}
@@ -0,0 +1,118 @@
+package commandparser
+
+import (
+	"errors"
+	"github.com/blissfulreboot/slagbot/internal/slackconnection"
+	"testing"
+)
+
+func TestCommandText(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		message slackconnection.SlackMessage
+		// text is the expected command text, empty if the message should not trigger the bot
+		text      string
+		addressed bool
+	}{
+		{name: "any", mode: TriggerAny, message: slackconnection.SlackMessage{Text: "deploy"}, text: "deploy"},
+		{
+			name:      "any with a mention",
+			mode:      TriggerAny,
+			message:   slackconnection.SlackMessage{Text: "deploy", Mentioned: true},
+			text:      "deploy",
+			addressed: true,
+		},
+		{
+			name:      "any with the prefix",
+			mode:      TriggerAny,
+			message:   slackconnection.SlackMessage{Text: "! deploy"},
+			text:      "deploy",
+			addressed: true,
+		},
+		{
+			name:      "mention",
+			mode:      TriggerMention,
+			message:   slackconnection.SlackMessage{Text: "deploy", Mentioned: true},
+			text:      "deploy",
+			addressed: true,
+		},
+		{
+			name:    "mention without a mention",
+			mode:    TriggerMention,
+			message: slackconnection.SlackMessage{Text: "deploy"},
+		},
+		{
+			name:      "prefix",
+			mode:      TriggerPrefix,
+			message:   slackconnection.SlackMessage{Text: "!deploy"},
+			text:      "deploy",
+			addressed: true,
+		},
+		{
+			name:    "prefix without the prefix",
+			mode:    TriggerPrefix,
+			message: slackconnection.SlackMessage{Text: "deploy", Mentioned: true},
+		},
+		{
+			name:      "direct message",
+			mode:      TriggerPrefix,
+			message:   slackconnection.SlackMessage{Text: "deploy", DirectMessage: true},
+			text:      "deploy",
+			addressed: true,
+		},
+		{
+			name:      "slash command",
+			mode:      TriggerPrefix,
+			message:   slackconnection.SlackMessage{Text: "app", SlashCommand: "/deploy"},
+			text:      "app",
+			addressed: true,
+		},
+		{
+			name:    "channel override",
+			mode:    TriggerAny,
+			message: slackconnection.SlackMessage{Text: "deploy", Channel: "CQUIET"},
+		},
+	}
+	for _, test := range tests {
+		policy := TriggerPolicy{
+			Mode:                 test.mode,
+			Prefix:               "!",
+			AcceptDirectMessages: true,
+			ChannelModes:         map[string]string{"CQUIET": TriggerMention},
+		}
+		text, triggered, addressed := policy.commandText(test.message)
+		if triggered != (test.text != "") || (triggered && text != test.text) || addressed != test.addressed {
+			t.Errorf("%s: commandText = %q, %t, %t, want %q, addressed %t", test.name, text, triggered, addressed,
+				test.text, test.addressed)
+		}
+	}
+}
+
+func TestUnmatchedMessages(t *testing.T) {
+	tests := []struct {
+		text      string
+		addressed bool
+		// unknown is true if the bot should reply that the command is unknown
+		unknown bool
+	}{
+		{text: "the build is broken", addressed: false},
+		{text: "the build is broken", addressed: true, unknown: true},
+		{text: "help me with the build", addressed: false},
+		{text: "deployy the app", addressed: false},
+		{text: "deployy the app", addressed: true, unknown: true},
+	}
+	for _, test := range tests {
+		ch := newTestHandler()
+		message := slackconnection.SlackMessage{Text: test.text, Channel: "C1"}
+		err := ch.dispatchMessage(message, test.addressed, testPlugins())
+		var unknownErr *unknownCommandError
+		if errors.As(err, &unknownErr) != test.unknown {
+			t.Errorf("dispatchMessage(%q, %t) = %v, want unknown command %t", test.text, test.addressed, err,
+				test.unknown)
+		}
+		if got := replies(ch); len(got) > 0 {
+			t.Errorf("dispatchMessage(%q, %t) replied %q, want no reply", test.text, test.addressed, got)
+		}
+	}
+}
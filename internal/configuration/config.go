@@ -1,17 +1,61 @@
 package configuration
 
 import (
+	"encoding/json"
 	"fmt"
 	"gitlab.com/blissfulreboot/golang/conffee"
 	"os"
 )
 
+const configurationFile = "slagbot.conf"
+
+// RoleDefinition lists the users that have the role. A user has the role if any of the lists matches.
+type RoleDefinition struct {
+	Users      []string
+	UserGroups []string
+	Emails     []string
+}
+
+// CommandPolicy restricts who can use the commands and where. Empty Plugin or Command matches all plugins or commands,
+// and a Command matches its subcommands too. When AllowedRoles is empty, the RequiredRole declared by the plugin in the
+// command is used.
+type CommandPolicy struct {
+	Plugin            string
+	Command           string
+	AllowedRoles      []string
+	AllowedChannels   []string
+	DirectMessageOnly bool
+}
+
 type Configuration struct {
 	LogLevel               string
 	LogEncoding            string
 	PluginDir              string
+	PluginDirs             []string
+	PluginRecursive        bool
+	PluginInclude          []string
+	PluginExclude          []string
+	DisabledPlugins        []string
 	PluginExtension        string
+	ExecPluginExtension    string
 	PluginExitGraceSeconds uint
+	PluginReloadSeconds    uint
+	PluginQueueSize        uint
+	PluginQueueTimeoutMs   uint
+	AdminChannel           string
+	MetricsListenAddress   string
+	OutgoingIntervalMs     uint
+	OutgoingBurst          uint
+	OutgoingQueueSize      uint
+	OutgoingMaxRetries     uint
+	OutgoingSplitLength    uint
+	OutgoingUploadLength   uint
+	TriggerMode            string
+	CommandPrefix          string
+	AcceptDirectMessages   bool
+	ChannelTriggerModes    map[string]string
+	Roles                  map[string]RoleDefinition
+	CommandPolicies        []CommandPolicy
 	SlackAppToken          string `conffee:"required=true"`
 	SlackBotToken          string `conffee:"required=true"`
 }
@@ -21,12 +65,35 @@ func ReadConfiguration() (*Configuration, error) {
 		LogLevel:               "info",
 		LogEncoding:            "console",
 		PluginDir:              "./",
+		PluginDirs:             []string{},
+		PluginRecursive:        false,
+		PluginInclude:          []string{},
+		PluginExclude:          []string{},
+		DisabledPlugins:        []string{},
 		PluginExtension:        ".plugin",
+		ExecPluginExtension:    ".exec",
 		PluginExitGraceSeconds: 5,
+		PluginReloadSeconds:    10,
+		PluginQueueSize:        16,
+		PluginQueueTimeoutMs:   200,
+		AdminChannel:           "",
+		MetricsListenAddress:   "",
+		OutgoingIntervalMs:     1000,
+		OutgoingBurst:          3,
+		OutgoingQueueSize:      1000,
+		OutgoingMaxRetries:     5,
+		OutgoingSplitLength:    4000,
+		OutgoingUploadLength:   0,
+		TriggerMode:            "any",
+		CommandPrefix:          "!",
+		AcceptDirectMessages:   true,
+		ChannelTriggerModes:    map[string]string{},
+		Roles:                  map[string]RoleDefinition{},
+		CommandPolicies:        []CommandPolicy{},
 		SlackAppToken:          "",
 		SlackBotToken:          "",
 	}
-	err := conffee.ReadConfiguration("./slagbot.conf", &conf, false, true)
+	err := conffee.ReadConfiguration("./"+configurationFile, &conf, false, true)
 	if err != nil {
 		return nil, err
 	}
@@ -35,5 +102,50 @@ func ReadConfiguration() (*Configuration, error) {
 		fmt.Println("Log encoding must be either 'json' or 'console' if defined. Default is 'console' if left undefined.")
 		os.Exit(1)
 	}
+	if !validTriggerMode(conf.TriggerMode) {
+		fmt.Println("Trigger mode must be 'any', 'mention' or 'prefix' if defined. Default is 'any' if left undefined.")
+		os.Exit(1)
+	}
+	for channel, mode := range conf.ChannelTriggerModes {
+		if !validTriggerMode(mode) {
+			fmt.Printf("Trigger mode of channel %s must be 'any', 'mention' or 'prefix'.\n", channel)
+			os.Exit(1)
+		}
+	}
 	return &conf, nil
 }
+
+func validTriggerMode(mode string) bool {
+	return mode == "any" || mode == "mention" || mode == "prefix"
+}
+
+// PluginDirectories returns the directories where the plugins are searched for.
+func (c *Configuration) PluginDirectories() []string {
+	if len(c.PluginDirs) > 0 {
+		return c.PluginDirs
+	}
+	return []string{c.PluginDir}
+}
+
+// ReadDisabledPlugins reads the DisabledPlugins list again from the configuration file, which is searched for like
+// when the bot starts, so that plugins can be disabled and enabled without restarting the bot.
+func ReadDisabledPlugins() ([]string, error) {
+	var content []byte
+	var readErr error
+	for _, path := range []string{"./" + configurationFile, "/etc/" + configurationFile} {
+		content, readErr = os.ReadFile(path)
+		if readErr == nil {
+			break
+		}
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	var conf struct {
+		DisabledPlugins []string
+	}
+	if err := json.Unmarshal(content, &conf); err != nil {
+		return nil, err
+	}
+	return conf.DisabledPlugins, nil
+}
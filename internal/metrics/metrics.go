@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"github.com/blissfulreboot/slagbot/pkg/interfaces"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*
+Metrics are published with expvar. When a listen address is configured, they can be read as JSON from
+http://<address>/debug/vars.
+*/
+
+// Counters keyed by the name of the plugin
+var (
+	CommandsDelivered = expvar.NewMap("commands_delivered")
+	CommandsRejected  = expvar.NewMap("commands_rejected")
+)
+
+// Counters of the outgoing messages. The dropped messages are keyed by the reason.
+var (
+	OutgoingDropped = expvar.NewMap("outgoing_dropped")
+	OutgoingRetries = expvar.NewInt("outgoing_retries")
+)
+
+// InteractionsDropped counts the clicks and modal submissions dropped because the interaction queue was full
+var InteractionsDropped = expvar.NewInt("interactions_dropped")
+
+var (
+	gaugesLock sync.Mutex
+	gauges     = make(map[string]func() interface{})
+)
+
+// Gauge publishes a value that is computed every time the metrics are read. expvar allows publishing a name only once,
+// so calling Gauge again with the same name replaces the function of the gauge.
+func Gauge(name string, f func() interface{}) {
+	gaugesLock.Lock()
+	defer gaugesLock.Unlock()
+	_, published := gauges[name]
+	gauges[name] = f
+	if published {
+		return
+	}
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		gaugesLock.Lock()
+		current := gauges[name]
+		gaugesLock.Unlock()
+		return current()
+	}))
+}
+
+// Serve serves the metrics until the context is done. Nothing is done if the address is empty.
+func Serve(listenAddress string, logger interfaces.LoggerInterface, wg *sync.WaitGroup, ctx context.Context) {
+	if listenAddress == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	server := &http.Server{
+		Addr:              listenAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		logger.Infof("Serving metrics on %s", listenAddress)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Metrics server failed")
+			logger.Debug(err)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		logger.Debug("Context done in metrics server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Debug(err)
+		}
+	}()
+}
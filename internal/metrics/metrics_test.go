@@ -0,0 +1,14 @@
+package metrics
+
+import (
+	"expvar"
+	"testing"
+)
+
+func TestGaugeCanBeRegisteredAgain(t *testing.T) {
+	Gauge("test_gauge", func() interface{} { return 1 })
+	Gauge("test_gauge", func() interface{} { return 2 })
+	if got := expvar.Get("test_gauge").String(); got != "2" {
+		t.Errorf("test_gauge = %s, want 2", got)
+	}
+}
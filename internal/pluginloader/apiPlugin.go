@@ -0,0 +1,166 @@
+package pluginloader
+
+import (
+	"context"
+	"fmt"
+	"github.com/blissfulreboot/slagbot/pkg/interfaces"
+	"github.com/blissfulreboot/slagbot/pkg/pluginapi"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"plugin"
+	"sync"
+)
+
+// pluginHost implements pluginapi.Host for a single plugin
+type pluginHost struct {
+	slackMessageChannel chan<- types.OutgoingSlackMessage
+	logger              interfaces.LoggerInterface
+}
+
+func (h *pluginHost) Logger() interfaces.LoggerInterface {
+	return h.logger
+}
+
+func (h *pluginHost) Send(msg types.OutgoingSlackMessage) {
+	h.slackMessageChannel <- msg
+}
+
+func (h *pluginHost) SendAndWait(ctx context.Context, msg types.OutgoingSlackMessage) (types.OutgoingResult, error) {
+	return types.Send(ctx, h.slackMessageChannel, msg)
+}
+
+// apiPlugin adapts a plugin implementing pluginapi.Plugin to the functions of ReadyPlugin
+type apiPlugin struct {
+	file   string
+	plugin pluginapi.Plugin
+	host   *pluginHost
+	ctx    context.Context
+	cancel context.CancelFunc
+	// handlers tracks the running Handle calls, so that stop can wait for them
+	handlers     sync.WaitGroup
+	handlersLock sync.Mutex
+	stopping     bool
+}
+
+// lookupAPIPlugin returns the Plugin symbol of the plugin if it exports one. The symbol is a pointer to the exported
+// variable, so both `var Plugin pluginapi.Plugin = &p{}` and `var Plugin p` (with pointer receivers) are accepted.
+func lookupAPIPlugin(plug *plugin.Plugin) (pluginapi.Plugin, bool) {
+	symbol, lookupErr := plug.Lookup(pluginapi.SymbolName)
+	if lookupErr != nil {
+		return nil, false
+	}
+	switch p := symbol.(type) {
+	case *pluginapi.Plugin:
+		return *p, *p != nil
+	case pluginapi.Plugin:
+		return p, true
+	default:
+		return nil, false
+	}
+}
+
+func startAPIPlugin(file string, p pluginapi.Plugin, slackMessageChannel chan<- types.OutgoingSlackMessage,
+	logger interfaces.LoggerInterface) (*apiPlugin, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	host := &pluginHost{
+		slackMessageChannel: slackMessageChannel,
+		logger:              logger,
+	}
+	if err := p.Init(ctx, host); err != nil {
+		cancel()
+		return nil, err
+	}
+	return &apiPlugin{
+		file:   file,
+		plugin: p,
+		host:   host,
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+func (p *apiPlugin) getCommands() []types.Command {
+	return p.plugin.Commands()
+}
+
+func (p *apiPlugin) interactionIDs() []string {
+	if interactive, isInteractive := p.plugin.(pluginapi.Interactive); isInteractive {
+		return interactive.InteractionIDs()
+	}
+	return nil
+}
+
+func (p *apiPlugin) run(cmdChannel chan types.ParsedCommand, _ chan<- types.OutgoingSlackMessage,
+	logger interfaces.LoggerInterface) {
+	for {
+		select {
+		case cmd := <-cmdChannel:
+			if !p.startHandler() {
+				return
+			}
+			go func() {
+				defer p.handlers.Done()
+				p.handle(cmd, logger)
+			}()
+		case <-p.ctx.Done():
+			logger.Debugf("Context done in plugin %s", p.file)
+			return
+		}
+	}
+}
+
+// handle calls the Handle function of the plugin. A panic fails only the command, the plugin stays loaded, since a Go
+// plugin cannot be loaded again to restart it.
+func (p *apiPlugin) handle(cmd types.ParsedCommand, logger interfaces.LoggerInterface) {
+	req := pluginapi.NewRequest(cmd, p.host)
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("Plugin %s panicked while handling the command %s: %v", p.file, cmd.Command, r)
+			req.Reply(fmt.Sprintf("Command `%s` failed unexpectedly", cmd.Command))
+		}
+	}()
+	if err := p.plugin.Handle(p.ctx, req); err != nil {
+		logger.Errorf("Plugin %s failed to handle the command %s", p.file, cmd.Command)
+		logger.Debug(err)
+		req.Reply(fmt.Sprintf("Command `%s` failed: %s", cmd.Command, err))
+	}
+}
+
+// startHandler adds a handler to the running ones unless the plugin is stopping.
+func (p *apiPlugin) startHandler() bool {
+	p.handlersLock.Lock()
+	defer p.handlersLock.Unlock()
+	if p.stopping {
+		return false
+	}
+	p.handlers.Add(1)
+	return true
+}
+
+// stop cancels the context of the plugin and waits until the running Handle calls have returned.
+func (p *apiPlugin) stop() {
+	p.handlersLock.Lock()
+	p.stopping = true
+	p.handlersLock.Unlock()
+	p.cancel()
+	p.handlers.Wait()
+}
+
+func prepareAPIPlugin(file string, plugin *apiPlugin, queueSize uint) (*ReadyPlugin, error) {
+	readyPlugin := ReadyPlugin{
+		File:           file,
+		Kind:           GoPlugin,
+		getCommands:    plugin.getCommands,
+		run:            plugin.run,
+		stop:           plugin.stop,
+		interactionIDs: plugin.interactionIDs,
+		Commands:       plugin.getCommands(),
+		CommandChannel: make(chan types.ParsedCommand, queueSize),
+		restartable:    false,
+		crashed:        make(chan string, 1),
+		recovered:      make(chan struct{}, 1),
+		stopped:        make(chan struct{}),
+		done:           make(chan struct{}),
+		healthy:        true,
+	}
+	return &readyPlugin, nil
+}
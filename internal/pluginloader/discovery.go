@@ -0,0 +1,187 @@
+package pluginloader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Discovery defines where the plugins are searched for. Include and Exclude are glob patterns (see filepath.Match)
+// that are matched against both the path relative to the plugin directory and the file name. Disabled lists plugins
+// by their name, path or file name that are not loaded even if they match the patterns. ReadDisabled, if set, is
+// called on every reload to get the current list of disabled plugins.
+type Discovery struct {
+	Dirs                []string
+	Recursive           bool
+	PluginExtension     string
+	ExecPluginExtension string
+	Include             []string
+	Exclude             []string
+	Disabled            []string
+	ReadDisabled        func() ([]string, error)
+}
+
+func (d Discovery) validate() error {
+	if len(d.Dirs) == 0 {
+		return errors.New("no plugin directories defined")
+	}
+	for _, pattern := range append(append([]string{}, d.Include...), d.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return errors.New(fmt.Sprintf("invalid plugin pattern '%s': %s", pattern, err))
+		}
+	}
+	return nil
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, filepath.Base(name)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (d Discovery) isDisabled(name string, path string) bool {
+	for _, disabled := range d.Disabled {
+		cleaned := filepath.Clean(disabled)
+		if cleaned == name || cleaned == filepath.Clean(path) || disabled == filepath.Base(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d Discovery) kind(name string) (PluginKind, bool) {
+	switch filepath.Ext(name) {
+	case d.PluginExtension:
+		return GoPlugin, true
+	case d.ExecPluginExtension:
+		return ExecPlugin, true
+	default:
+		return "", false
+	}
+}
+
+// refreshDisabled updates the list of disabled plugins. The previous list is kept if the list cannot be read, e.g.
+// when the bot is configured without a configuration file.
+func (m *PluginManager) refreshDisabled() {
+	if m.discovery.ReadDisabled == nil {
+		return
+	}
+	disabled, readErr := m.discovery.ReadDisabled()
+	if errors.Is(readErr, os.ErrNotExist) {
+		return
+	}
+	if readErr != nil {
+		m.logger.Error("Could not read the list of disabled plugins, using the previous list")
+		m.logger.Debug(readErr)
+		return
+	}
+	m.discovery.Disabled = disabled
+}
+
+// scan lists the plugins in the plugin directories. Go plugins are listed before executable plugins. The name of a
+// plugin is its path relative to the plugin directory, unless the same relative path is found in several directories.
+// Then the full paths are used as the names, so that every plugin has a unique name. A file that is found through
+// several directories, e.g. when the directories overlap or one is listed twice, is listed only once.
+func (m *PluginManager) scan() ([]pluginFile, error) {
+	m.refreshDisabled()
+	var files []pluginFile
+	seen := make(map[string]struct{})
+	for _, dir := range m.discovery.Dirs {
+		walkErr := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if path == dir && errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+				// An unreadable file or directory does not prevent loading the other plugins
+				m.logger.Errorf("Could not read %s in the plugin directory %s", path, dir)
+				m.logger.Debug(err)
+				if entry != nil && entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if entry.IsDir() {
+				if path != dir && !m.discovery.Recursive {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			name, relErr := filepath.Rel(dir, path)
+			if relErr != nil {
+				return relErr
+			}
+			kind, isPlugin := m.discovery.kind(name)
+			if !isPlugin {
+				return nil
+			}
+			if len(m.discovery.Include) > 0 && !matchesAny(m.discovery.Include, name) {
+				return nil
+			}
+			if matchesAny(m.discovery.Exclude, name) {
+				return nil
+			}
+			if m.discovery.isDisabled(name, path) {
+				m.logger.Debugf("Plugin %s is disabled", name)
+				return nil
+			}
+
+			absPath, absErr := filepath.Abs(path)
+			if absErr != nil {
+				return absErr
+			}
+			if _, isSeen := seen[absPath]; isSeen {
+				m.logger.Debugf("Plugin %s was already found in another plugin directory", path)
+				return nil
+			}
+			seen[absPath] = struct{}{}
+
+			info, infoErr := entry.Info()
+			if infoErr != nil {
+				m.logger.Errorf("Could not read the file info of plugin %s", path)
+				m.logger.Debug(infoErr)
+				return nil
+			}
+			files = append(files, pluginFile{
+				name:    name,
+				path:    path,
+				kind:    kind,
+				modTime: info.ModTime(),
+				size:    info.Size(),
+			})
+			return nil
+		})
+		if walkErr != nil {
+			if errors.Is(walkErr, os.ErrNotExist) {
+				m.logger.Errorf("Plugin directory %s does not exist", dir)
+				continue
+			}
+			return nil, walkErr
+		}
+	}
+
+	dirCount := make(map[string]int)
+	for _, file := range files {
+		dirCount[file.name]++
+	}
+	var goPluginFiles []pluginFile
+	var execPluginFiles []pluginFile
+	for _, file := range files {
+		if dirCount[file.name] > 1 {
+			file.name = file.path
+		}
+		if file.kind == GoPlugin {
+			goPluginFiles = append(goPluginFiles, file)
+		} else {
+			execPluginFiles = append(execPluginFiles, file)
+		}
+	}
+	return append(goPluginFiles, execPluginFiles...), nil
+}
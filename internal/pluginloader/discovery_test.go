@@ -0,0 +1,77 @@
+package pluginloader
+
+import (
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestManager(dirs ...string) *PluginManager {
+	return &PluginManager{
+		discovery: Discovery{
+			Dirs:                dirs,
+			Recursive:           true,
+			PluginExtension:     ".so",
+			ExecPluginExtension: ".plugin",
+		},
+		logger: zap.NewNop().Sugar(),
+		loaded: make(map[string]*loadedPlugin),
+		failed: make(map[string]pluginFile),
+	}
+}
+
+func writeTestFile(t *testing.T, path string, perm os.FileMode) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), perm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanListsEachPluginOnce(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.plugin"), 0755)
+	writeTestFile(t, filepath.Join(dir, "sub", "b.plugin"), 0755)
+
+	m := newTestManager(dir, dir+string(filepath.Separator), filepath.Join(dir, "sub"), filepath.Join(dir, "."))
+	files, err := m.scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.name)
+	}
+	want := []string{"a.plugin", filepath.Join("sub", "b.plugin")}
+	if len(names) != len(want) || names[0] != want[0] || names[1] != want[1] {
+		t.Errorf("scan() found the plugins %v, want %v", names, want)
+	}
+}
+
+func TestReloadForgetsRemovedFailedPlugins(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "broken.plugin")
+	// The plugin cannot be started since it is not executable
+	writeTestFile(t, path, 0644)
+
+	m := newTestManager(dir)
+	if err := m.reload(false); err != nil {
+		t.Fatal(err)
+	}
+	if _, hasFailed := m.failed[path]; !hasFailed {
+		t.Fatalf("the broken plugin was not recorded as failed: %v", m.failed)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.reload(false); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.failed) != 0 {
+		t.Errorf("the removed plugin is still recorded as failed: %v", m.failed)
+	}
+}
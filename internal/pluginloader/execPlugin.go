@@ -0,0 +1,408 @@
+package pluginloader
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/blissfulreboot/slagbot/pkg/interfaces"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+/*
+Executable plugins are separate processes that talk with the bot over stdin/stdout. Every line is a single JSON-RPC 2.0
+message. The bot sends the "GetCommands" request once after starting the process, "ParsedCommand" notifications for
+every matched command and a "Stop" notification when the bot is shutting down. The plugin sends
+"OutgoingSlackMessage" notifications whenever it wants to post something to Slack, or requests if it needs the ts of
+the message or the error, and a "RegisterInteractionIDs" notification to receive the interactions with its messages.
+Everything the plugin writes to stderr is passed to the bot's logger.
+*/
+
+const (
+	rpcVersion               = "2.0"
+	rpcMethodGetCommands     = "GetCommands"
+	rpcMethodParsedCommand   = "ParsedCommand"
+	rpcMethodStop            = "Stop"
+	rpcMethodOutgoingMessage = "OutgoingSlackMessage"
+	rpcMethodRegisterIDs     = "RegisterInteractionIDs"
+	execPluginRequestTimeout = 10 * time.Second
+	execPluginMaxLineBytes   = 1024 * 1024
+)
+
+// Error codes of the responses to OutgoingSlackMessage requests, from the range reserved for implementations
+const (
+	rpcErrorSendFailed        = -32000
+	rpcErrorRecipientNotFound = -32001
+)
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *uint64         `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type execParsedCommand struct {
+	types.ParsedCommand
+	UserProfile *types.UserProfile `json:"user_profile,omitempty"`
+}
+
+type execPlugin struct {
+	path                string
+	cmd                 *exec.Cmd
+	stdin               io.WriteCloser
+	writeLock           sync.Mutex
+	encoder             *json.Encoder
+	pendingLock         sync.Mutex
+	pending             map[uint64]chan rpcMessage
+	nextId              uint64
+	slackMessageChannel chan<- types.OutgoingSlackMessage
+	exited              chan struct{}
+	crashed             chan string
+	interactionLock     sync.RWMutex
+	interactionIDList   []string
+	stopLock            sync.Mutex
+	stopping            bool
+	gracePeriod         time.Duration
+	logger              interfaces.LoggerInterface
+}
+
+func startExecPlugin(path string, gracePeriod time.Duration, slackMessageChannel chan<- types.OutgoingSlackMessage,
+	logger interfaces.LoggerInterface) (*execPlugin, error) {
+	// Use the absolute path so that exec does not search the file from PATH
+	absolutePath, absErr := filepath.Abs(path)
+	if absErr != nil {
+		return nil, absErr
+	}
+	cmd := exec.Command(absolutePath)
+	// Run the plugin in its own process group, so that an interrupt from the terminal reaches only the bot, which
+	// then stops the plugin gracefully
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	stdin, stdinErr := cmd.StdinPipe()
+	if stdinErr != nil {
+		return nil, stdinErr
+	}
+	stdout, stdoutErr := cmd.StdoutPipe()
+	if stdoutErr != nil {
+		return nil, stdoutErr
+	}
+	stderr, stderrErr := cmd.StderrPipe()
+	if stderrErr != nil {
+		return nil, stderrErr
+	}
+	if startErr := cmd.Start(); startErr != nil {
+		return nil, startErr
+	}
+
+	p := &execPlugin{
+		path:                path,
+		cmd:                 cmd,
+		stdin:               stdin,
+		encoder:             json.NewEncoder(stdin),
+		pending:             make(map[uint64]chan rpcMessage),
+		slackMessageChannel: slackMessageChannel,
+		exited:              make(chan struct{}),
+		crashed:             make(chan string, 1),
+		gracePeriod:         gracePeriod,
+		logger:              logger,
+	}
+
+	go p.readStderr(stderr)
+	go p.readStdout(stdout)
+
+	return p, nil
+}
+
+func (p *execPlugin) readStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		p.logger.Infof("[%s] %s", p.path, scanner.Text())
+	}
+}
+
+func (p *execPlugin) readStdout(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), execPluginMaxLineBytes)
+	for scanner.Scan() {
+		var msg rpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			p.logger.Errorf("Plugin %s sent an invalid message", p.path)
+			p.logger.Debug(err)
+			continue
+		}
+		p.handleMessage(msg)
+	}
+	if scanErr := scanner.Err(); scanErr != nil {
+		p.logger.Errorf("Failed to read the output of plugin %s", p.path)
+		p.logger.Debug(scanErr)
+	}
+
+	waitErr := p.cmd.Wait()
+	p.logger.Infof("Plugin %s exited", p.path)
+	if waitErr != nil {
+		p.logger.Debug(waitErr)
+	}
+	close(p.exited)
+
+	p.stopLock.Lock()
+	defer p.stopLock.Unlock()
+	if !p.stopping {
+		reason := "the process exited unexpectedly"
+		if waitErr != nil {
+			reason = fmt.Sprintf("the process exited unexpectedly: %s", waitErr)
+		}
+		select {
+		case p.crashed <- reason:
+		default:
+		}
+	}
+}
+
+func (p *execPlugin) handleMessage(msg rpcMessage) {
+	// Messages without a method are responses to the requests sent by the bot
+	if msg.Method == "" {
+		if msg.ID == nil {
+			p.logger.Errorf("Plugin %s sent a response without an id", p.path)
+			return
+		}
+		p.pendingLock.Lock()
+		responseChannel, ok := p.pending[*msg.ID]
+		delete(p.pending, *msg.ID)
+		p.pendingLock.Unlock()
+		if !ok {
+			p.logger.Errorf("Plugin %s sent a response to an unknown request %d", p.path, *msg.ID)
+			return
+		}
+		responseChannel <- msg
+		return
+	}
+
+	switch msg.Method {
+	case rpcMethodOutgoingMessage:
+		var outgoing types.OutgoingSlackMessage
+		if err := json.Unmarshal(msg.Params, &outgoing); err != nil {
+			p.logger.Errorf("Plugin %s sent an invalid %s", p.path, rpcMethodOutgoingMessage)
+			p.logger.Debug(err)
+			return
+		}
+		// As a request, the plugin gets the channel and the ts of the message in the response
+		if msg.ID != nil {
+			result := make(chan types.OutgoingResult, 1)
+			outgoing.Result = result
+			go p.respondResult(*msg.ID, result)
+		}
+		p.slackMessageChannel <- outgoing
+	case rpcMethodRegisterIDs:
+		var ids []string
+		if err := json.Unmarshal(msg.Params, &ids); err != nil {
+			p.logger.Errorf("Plugin %s sent an invalid %s", p.path, rpcMethodRegisterIDs)
+			p.logger.Debug(err)
+			return
+		}
+		p.interactionLock.Lock()
+		p.interactionIDList = ids
+		p.interactionLock.Unlock()
+	default:
+		p.logger.Errorf("Plugin %s called an unknown method %s", p.path, msg.Method)
+	}
+}
+
+// respondResult sends the result of an OutgoingSlackMessage request to the plugin
+func (p *execPlugin) respondResult(id uint64, result <-chan types.OutgoingResult) {
+	select {
+	case outgoingResult := <-result:
+		response := rpcMessage{JSONRPC: rpcVersion, ID: &id}
+		if outgoingResult.Err != nil {
+			response.Error = &rpcError{Code: rpcErrorSendFailed, Message: outgoingResult.Err.Error()}
+			var notFoundErr *types.RecipientNotFoundError
+			if errors.As(outgoingResult.Err, &notFoundErr) {
+				response.Error.Code = rpcErrorRecipientNotFound
+			}
+		} else {
+			rawResult, marshalErr := json.Marshal(outgoingResult)
+			if marshalErr != nil {
+				p.logger.Debug(marshalErr)
+				return
+			}
+			response.Result = rawResult
+		}
+		if err := p.write(response); err != nil {
+			p.logger.Errorf("Could not send the result of message %d to plugin %s", id, p.path)
+			p.logger.Debug(err)
+		}
+	case <-p.exited:
+	}
+}
+
+func (p *execPlugin) write(msg rpcMessage) error {
+	p.writeLock.Lock()
+	defer p.writeLock.Unlock()
+	return p.encoder.Encode(msg)
+}
+
+func (p *execPlugin) notify(method string, params interface{}) error {
+	var rawParams json.RawMessage
+	if params != nil {
+		var marshalErr error
+		rawParams, marshalErr = json.Marshal(params)
+		if marshalErr != nil {
+			return marshalErr
+		}
+	}
+	return p.write(rpcMessage{
+		JSONRPC: rpcVersion,
+		Method:  method,
+		Params:  rawParams,
+	})
+}
+
+func (p *execPlugin) request(method string, result interface{}) error {
+	p.pendingLock.Lock()
+	p.nextId++
+	id := p.nextId
+	responseChannel := make(chan rpcMessage, 1)
+	p.pending[id] = responseChannel
+	p.pendingLock.Unlock()
+	// The entry is removed by handleMessage when the response arrives, otherwise here
+	defer func() {
+		p.pendingLock.Lock()
+		delete(p.pending, id)
+		p.pendingLock.Unlock()
+	}()
+
+	writeErr := p.write(rpcMessage{
+		JSONRPC: rpcVersion,
+		ID:      &id,
+		Method:  method,
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+
+	select {
+	case response := <-responseChannel:
+		if response.Error != nil {
+			return errors.New(fmt.Sprintf("%s failed with code %d: %s", method, response.Error.Code,
+				response.Error.Message))
+		}
+		return json.Unmarshal(response.Result, result)
+	case <-p.exited:
+		return errors.New(fmt.Sprintf("plugin exited before responding to %s", method))
+	case <-time.After(execPluginRequestTimeout):
+		return errors.New(fmt.Sprintf("timeout while waiting response to %s", method))
+	}
+}
+
+func (p *execPlugin) getCommands() []types.Command {
+	var commands []types.Command
+	if err := p.request(rpcMethodGetCommands, &commands); err != nil {
+		p.logger.Errorf("Could not get the commands from plugin %s", p.path)
+		p.logger.Debug(err)
+		return nil
+	}
+	return commands
+}
+
+func (p *execPlugin) interactionIDs() []string {
+	p.interactionLock.RLock()
+	defer p.interactionLock.RUnlock()
+	return p.interactionIDList
+}
+
+func (p *execPlugin) run(cmdChannel chan types.ParsedCommand, _ chan<- types.OutgoingSlackMessage,
+	_ interfaces.LoggerInterface) {
+	for {
+		select {
+		case cmd := <-cmdChannel:
+			// The user profile cannot be resolved lazily over the pipe, so it is resolved before sending the command
+			profile, profileErr := cmd.User.Profile()
+			if profileErr != nil {
+				p.logger.Errorf("Could not resolve the profile of user %s", cmd.User.ID)
+				p.logger.Debug(profileErr)
+			}
+			payload := execParsedCommand{
+				ParsedCommand: cmd,
+				UserProfile:   profile,
+			}
+			if err := p.notify(rpcMethodParsedCommand, payload); err != nil {
+				p.logger.Errorf("Could not send the command to plugin %s", p.path)
+				p.logger.Debug(err)
+			}
+		case <-p.exited:
+			return
+		}
+	}
+}
+
+// stop asks the plugin to exit and kills it if it has not exited after the grace period. Writing to the plugin blocks
+// if it does not read its stdin, so the Stop notification is sent in the background and stdin is closed on kill, which
+// makes the pending writes fail.
+func (p *execPlugin) stop() {
+	p.stopLock.Lock()
+	p.stopping = true
+	p.stopLock.Unlock()
+
+	gracePeriod := time.NewTimer(p.gracePeriod)
+	defer gracePeriod.Stop()
+	go func() {
+		if err := p.notify(rpcMethodStop, nil); err != nil {
+			p.logger.Debug(err)
+		}
+		p.stdin.Close()
+	}()
+
+	select {
+	case <-p.exited:
+		return
+	case <-gracePeriod.C:
+	}
+	p.logger.Errorf("Plugin %s did not exit in time, killing it", p.path)
+	if killErr := p.cmd.Process.Kill(); killErr != nil {
+		p.logger.Debug(killErr)
+	}
+	p.stdin.Close()
+	select {
+	case <-p.exited:
+	case <-time.After(stopKillMargin):
+		p.logger.Errorf("Plugin %s did not exit after it was killed", p.path)
+	}
+}
+
+func prepareExecPlugin(file string, plugin *execPlugin, queueSize uint) (*ReadyPlugin, error) {
+	var commands []types.Command
+	if err := plugin.request(rpcMethodGetCommands, &commands); err != nil {
+		plugin.stop()
+		return nil, err
+	}
+
+	readyPlugin := ReadyPlugin{
+		File:           file,
+		Kind:           ExecPlugin,
+		getCommands:    plugin.getCommands,
+		run:            plugin.run,
+		stop:           plugin.stop,
+		interactionIDs: plugin.interactionIDs,
+		Commands:       commands,
+		CommandChannel: make(chan types.ParsedCommand, queueSize),
+		restartable:    true,
+		crashed:        plugin.crashed,
+		recovered:      make(chan struct{}, 1),
+		stopped:        make(chan struct{}),
+		done:           make(chan struct{}),
+		healthy:        true,
+	}
+	return &readyPlugin, nil
+}
@@ -0,0 +1,77 @@
+package pluginloader
+
+import (
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTestExecPlugin starts a shell script as an executable plugin
+func startTestExecPlugin(t *testing.T, script string, gracePeriod time.Duration) *execPlugin {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.plugin")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	plugin, err := startExecPlugin(path, gracePeriod, make(chan types.OutgoingSlackMessage), zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("could not start the plugin: %v", err)
+	}
+	return plugin
+}
+
+func TestExecPluginStopKillsPluginThatDoesNotReadStdin(t *testing.T) {
+	plugin := startTestExecPlugin(t, "exec sleep 60", 200*time.Millisecond)
+
+	// Fill the pipe, so that the writes block while holding the write lock
+	written := make(chan struct{}, 1)
+	go func() {
+		filler := strings.Repeat("x", 4*1024)
+		for {
+			if err := plugin.notify(rpcMethodParsedCommand, filler); err != nil {
+				return
+			}
+			select {
+			case written <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	<-written
+	time.Sleep(100 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		plugin.stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stop was still blocked 5s after the grace period")
+	}
+	select {
+	case <-plugin.exited:
+	default:
+		t.Error("the plugin was not killed after the grace period")
+	}
+}
+
+func TestExecPluginStopWaitsForExit(t *testing.T) {
+	plugin := startTestExecPlugin(t, "cat > /dev/null", 5*time.Second)
+
+	start := time.Now()
+	plugin.stop()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("stop took %s, want the plugin to exit when its stdin is closed", elapsed)
+	}
+	select {
+	case <-plugin.exited:
+	default:
+		t.Error("stop returned before the plugin exited")
+	}
+}
@@ -3,12 +3,11 @@ package pluginloader
 import (
 	"context"
 	"errors"
-	"fmt"
+	"github.com/blissfulreboot/slagbot/internal/metrics"
 	"github.com/blissfulreboot/slagbot/pkg/interfaces"
 	"github.com/blissfulreboot/slagbot/pkg/types"
-	"os"
-	"path/filepath"
 	"plugin"
+	"strings"
 	"sync"
 	"time"
 )
@@ -17,16 +16,71 @@ type pluginGetCommandFunc func() []types.Command
 type pluginRunFunc func(chan types.ParsedCommand, chan<- types.OutgoingSlackMessage, interfaces.LoggerInterface)
 type pluginStopFunc func()
 
+type PluginKind string
+
+const (
+	GoPlugin   PluginKind = "go"
+	ExecPlugin PluginKind = "exec"
+)
+
 type ReadyPlugin struct {
 	File           string
+	Kind           PluginKind
 	getCommands    func() []types.Command
 	run            func(chan types.ParsedCommand, chan<- types.OutgoingSlackMessage, interfaces.LoggerInterface)
 	stop           func()
+	interactionIDs func() []string
 	Commands       []types.Command
 	CommandChannel chan types.ParsedCommand
+	// restartable plugins are restarted by the manager after a crash. Only executable plugins can be restarted, since
+	// plugin.Open returns the already loaded Go plugin.
+	restartable bool
+	crashed     chan string
+	// recovered is signalled when a plugin that was not restarted after its queue got stuck reads its queue again
+	recovered chan struct{}
+	stopped   chan struct{}
+	stopOnce  sync.Once
+	// done is closed when the stop function of the plugin has returned. For legacy plugins this only means that Stop
+	// returned, the Run function may still be running.
+	done        chan struct{}
+	healthLock  sync.RWMutex
+	healthy     bool
+	startedAt   time.Time
+	sendTimeout time.Duration
+	fullLock    sync.Mutex
+	fullSince   time.Time
+	stuck       bool
 }
 
-func preparePlugin(file string, plugin *plugin.Plugin) (*ReadyPlugin, error) {
+// AllCommands returns the commands of the plugin including the subcommands, which have the full keyword path, e.g.
+// "deploy status".
+func (p *ReadyPlugin) AllCommands() []types.Command {
+	var commands []types.Command
+	for _, cmd := range p.Commands {
+		commands = append(commands, cmd.Flatten()...)
+	}
+	return commands
+}
+
+// InteractionPrefix returns the longest of the interaction id prefixes registered by the plugin that the id starts
+// with. The prefixes are the beginnings of the action ids (buttons and menus) and callback ids (modals) the plugin
+// handles.
+func (p *ReadyPlugin) InteractionPrefix(id string) (string, bool) {
+	if p.interactionIDs == nil {
+		return "", false
+	}
+	longest := ""
+	found := false
+	for _, prefix := range p.interactionIDs() {
+		if prefix != "" && strings.HasPrefix(id, prefix) && len(prefix) > len(longest) {
+			longest = prefix
+			found = true
+		}
+	}
+	return longest, found
+}
+
+func preparePlugin(file string, plugin *plugin.Plugin, queueSize uint) (*ReadyPlugin, error) {
 	// Lookup the required symbols
 	gcSymbol, gcSymbolLookupErr := plugin.Lookup("GetCommands")
 	if gcSymbolLookupErr != nil {
@@ -55,71 +109,96 @@ func preparePlugin(file string, plugin *plugin.Plugin) (*ReadyPlugin, error) {
 		return nil, errors.New("the stop symbol is not a function")
 	}
 
+	// GetInteractionIDs is optional
+	var interactionIDsFunc func() []string
+	if iidSymbol, iidSymbolLookupErr := plugin.Lookup("GetInteractionIDs"); iidSymbolLookupErr == nil {
+		var iidSymbolAssertionOk bool
+		interactionIDsFunc, iidSymbolAssertionOk = iidSymbol.(func() []string)
+		if !iidSymbolAssertionOk {
+			return nil, errors.New("the getInteractionIDs symbol is not a function")
+		}
+	}
+
 	commands := gcFunc()
 
 	readyPlugin := ReadyPlugin{
 		File:           file,
+		Kind:           GoPlugin,
 		getCommands:    gcFunc,
 		run:            runFunc,
 		stop:           stopFunc,
+		interactionIDs: interactionIDsFunc,
 		Commands:       commands,
-		CommandChannel: make(chan types.ParsedCommand),
+		CommandChannel: make(chan types.ParsedCommand, queueSize),
+		restartable:    false,
+		crashed:        make(chan string, 1),
+		recovered:      make(chan struct{}, 1),
+		stopped:        make(chan struct{}),
+		done:           make(chan struct{}),
+		healthy:        true,
 	}
 	return &readyPlugin, nil
 }
 
-func LoadPlugins(plugindir string, pluginExtension string, pluginGracePeriodSeconds uint, logger interfaces.LoggerInterface,
-	slackMessageChannel chan<- types.OutgoingSlackMessage, wg *sync.WaitGroup, ctx context.Context) ([]*ReadyPlugin, error) {
+// CommandPreparer validates the commands of a plugin when it is loaded and returns them in the form they are used in.
+// A plugin whose commands are rejected is not loaded.
+type CommandPreparer func(commands []types.Command) ([]types.Command, error)
 
-	files, err := os.ReadDir(plugindir)
-	if err != nil {
-		return nil, err
-	}
-	var pluginFiles []string
-	for _, file := range files {
-		if !file.IsDir() && filepath.Ext(file.Name()) == pluginExtension {
-			pluginFiles = append(pluginFiles, file.Name())
-		}
+func LoadPlugins(discovery Discovery, prepareCommands CommandPreparer, pluginGracePeriodSeconds uint,
+	pluginReloadIntervalSeconds uint, queueSize uint, queueTimeoutMillis uint, adminChannel string,
+	logger interfaces.LoggerInterface, slackMessageChannel chan<- types.OutgoingSlackMessage, wg *sync.WaitGroup,
+	ctx context.Context) (*PluginManager, error) {
+	if validationErr := discovery.validate(); validationErr != nil {
+		return nil, validationErr
 	}
 
-	var loadedPlugins []*ReadyPlugin
-	for _, file := range pluginFiles {
-		logger.Infof("Attempting to load plugin %s", file)
-		plug, pluginError := plugin.Open(file)
-		if pluginError != nil {
-			logger.Error(fmt.Sprintf("Could not load plug %s", file))
-			logger.Debug(pluginError)
-			continue
-		}
-		logger.Infof("Plugin %s loaded. Preparing it...", file)
-		readyPlugin, initErr := preparePlugin(file, plug)
-		if initErr != nil {
-			return nil, initErr
-		}
-		logger.Infof("Plugin %s prepared. Calling the run function", file)
-		go readyPlugin.run(readyPlugin.CommandChannel, slackMessageChannel, logger)
-
-		loadedPlugins = append(loadedPlugins, readyPlugin)
+	manager := &PluginManager{
+		discovery:           discovery,
+		prepareCommands:     prepareCommands,
+		gracePeriod:         time.Duration(pluginGracePeriodSeconds) * time.Second,
+		slackMessageChannel: slackMessageChannel,
+		logger:              logger,
+		loaded:              make(map[string]*loadedPlugin),
+		failed:              make(map[string]pluginFile),
+		queueSize:           queueSize,
+		queueTimeout:        time.Duration(queueTimeoutMillis) * time.Millisecond,
+		adminChannel:        adminChannel,
+		restarts:            make(map[string]int),
+		ctx:                 ctx,
+		stopped:             make(chan struct{}),
+		stopping:            make(map[*ReadyPlugin]struct{}),
+	}
+	if err := manager.reload(true); err != nil {
+		return nil, err
 	}
+	metrics.Gauge("plugin_queues", manager.queueDepths)
 
-	// Handler for external stop signal
+	// Handler for periodic reloads and external stop signal
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		var reloadTick <-chan time.Time
+		if pluginReloadIntervalSeconds > 0 {
+			ticker := time.NewTicker(time.Duration(pluginReloadIntervalSeconds) * time.Second)
+			defer ticker.Stop()
+			reloadTick = ticker.C
+		}
 		for {
 			select {
+			case <-reloadTick:
+				if reloadErr := manager.Reload(); reloadErr != nil {
+					logger.Error("Failed to reload the plugins")
+					logger.Debug(reloadErr)
+				}
 			case <-ctx.Done():
 				logger.Debug("Context done in LoadPlugins")
-				for _, plug := range loadedPlugins {
-					go plug.stop()
-				}
-				logger.Infof("stop called for all logging, waiting for %ds before continuing to allow graceful exit.", pluginGracePeriodSeconds)
-				time.Sleep(time.Duration(pluginGracePeriodSeconds) * time.Second)
+				logger.Infof("Stopping all plugins, waiting for %ds at most to allow graceful exit.",
+					pluginGracePeriodSeconds)
+				manager.stopAll()
 				return
 			}
 		}
-		logger.Info("Done")
 	}()
 
-	return loadedPlugins, nil
+	return manager, nil
 }
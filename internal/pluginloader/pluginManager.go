@@ -0,0 +1,360 @@
+package pluginloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/blissfulreboot/slagbot/pkg/interfaces"
+	"github.com/blissfulreboot/slagbot/pkg/pluginapi"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"plugin"
+	"strings"
+	"sync"
+	"time"
+)
+
+type pluginFile struct {
+	// name is the path relative to the plugin directory, used as the name of the plugin
+	name    string
+	path    string
+	kind    PluginKind
+	modTime time.Time
+	size    int64
+}
+
+func (f pluginFile) changedFrom(other pluginFile) bool {
+	return !f.modTime.Equal(other.modTime) || f.size != other.size
+}
+
+type loadedPlugin struct {
+	file   pluginFile
+	plugin *ReadyPlugin
+}
+
+// PluginManager owns the loaded plugins and the routing table built from them. The table is swapped as a whole when
+// the plugins are reloaded, so readers always see a consistent set of plugins.
+type PluginManager struct {
+	discovery           Discovery
+	prepareCommands     CommandPreparer
+	gracePeriod         time.Duration
+	slackMessageChannel chan<- types.OutgoingSlackMessage
+	logger              interfaces.LoggerInterface
+	routingLock         sync.RWMutex
+	plugins             []*ReadyPlugin
+	reloadLock          sync.Mutex
+	loaded              map[string]*loadedPlugin
+	failed              map[string]pluginFile
+	queueSize           uint
+	queueTimeout        time.Duration
+	adminChannel        string
+	restartLock         sync.Mutex
+	restarts            map[string]int
+	ctx                 context.Context
+	stopped             chan struct{}
+	stoppingLock        sync.Mutex
+	stopping            map[*ReadyPlugin]struct{}
+}
+
+// Plugins returns a snapshot of the currently loaded plugins.
+func (m *PluginManager) Plugins() []*ReadyPlugin {
+	m.routingLock.RLock()
+	defer m.routingLock.RUnlock()
+	return m.plugins
+}
+
+// WithPlugins calls f with a snapshot of the currently loaded plugins. The lock is not held while f runs, so a plugin
+// that does not read its commands cannot block a reload. A plugin that is stopped meanwhile rejects the commands
+// delivered to it with ErrPluginUnavailable.
+func (m *PluginManager) WithPlugins(f func(plugins []*ReadyPlugin) error) error {
+	return f(m.Plugins())
+}
+
+// Reload scans the plugin directories, loads new plugins, restarts changed executable plugins and stops the plugins
+// whose files have been removed.
+func (m *PluginManager) Reload() error {
+	m.logger.Debug("Reloading plugins")
+	return m.reload(false)
+}
+
+// load loads and starts the plugin. Nil plugin without an error means that the plugin could not be opened, which is
+// only logged.
+func (m *PluginManager) load(file pluginFile) (readyPlugin *ReadyPlugin, initErr error) {
+	// Panics in the functions of the plugin called while preparing it must not crash the bot
+	defer func() {
+		if r := recover(); r != nil {
+			readyPlugin = nil
+			initErr = errors.New(fmt.Sprintf("panic while preparing plugin %s: %v", file.name, r))
+		}
+	}()
+
+	switch file.kind {
+	case GoPlugin:
+		m.logger.Infof("Attempting to load plugin %s", file.name)
+		plug, pluginError := plugin.Open(file.path)
+		if pluginError != nil {
+			m.logger.Error(fmt.Sprintf("Could not load plug %s", file.name))
+			m.logger.Debug(pluginError)
+			return nil, nil
+		}
+		if p, isAPIPlugin := lookupAPIPlugin(plug); isAPIPlugin {
+			m.logger.Infof("Plugin %s loaded. It uses the plugin API v%d, initializing it...", file.name,
+				pluginapi.Version)
+			apiPlug, startErr := startAPIPlugin(file.name, p, m.slackMessageChannel, m.logger)
+			if startErr != nil {
+				return nil, startErr
+			}
+			readyPlugin, initErr = prepareAPIPlugin(file.name, apiPlug, m.queueSize)
+			break
+		}
+		m.logger.Infof("Plugin %s loaded. Preparing it...", file.name)
+		readyPlugin, initErr = preparePlugin(file.name, plug, m.queueSize)
+	case ExecPlugin:
+		m.logger.Infof("Attempting to start executable plugin %s", file.name)
+		execPlug, startErr := startExecPlugin(file.path, m.gracePeriod,
+			m.slackMessageChannel, m.logger)
+		if startErr != nil {
+			m.logger.Error(fmt.Sprintf("Could not start executable plugin %s", file.name))
+			m.logger.Debug(startErr)
+			return nil, nil
+		}
+		m.logger.Infof("Plugin %s started. Preparing it...", file.name)
+		readyPlugin, initErr = prepareExecPlugin(file.name, execPlug, m.queueSize)
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown plugin kind '%s'", file.kind))
+	}
+	if initErr != nil {
+		return nil, initErr
+	}
+	if m.prepareCommands != nil {
+		commands, prepareErr := m.prepareCommands(readyPlugin.Commands)
+		if prepareErr != nil {
+			readyPlugin.shutdown()
+			return nil, errors.New(fmt.Sprintf("invalid commands in plugin %s: %s", file.name, prepareErr))
+		}
+		readyPlugin.Commands = commands
+	}
+
+	m.logger.Infof("Plugin %s prepared. Calling the run function", file.name)
+	m.start(readyPlugin, file)
+	return readyPlugin, nil
+}
+
+func (m *PluginManager) reload(failOnPrepareErr bool) error {
+	m.reloadLock.Lock()
+	defer m.reloadLock.Unlock()
+
+	files, scanErr := m.scan()
+	if scanErr != nil {
+		return scanErr
+	}
+
+	// Failed plugins that have been removed or disabled are forgotten, so that they are tried again if they come back
+	scanned := make(map[string]struct{})
+	for _, file := range files {
+		scanned[file.path] = struct{}{}
+	}
+	for path := range m.failed {
+		if _, isScanned := scanned[path]; !isScanned {
+			delete(m.failed, path)
+		}
+	}
+
+	var toStop []*ReadyPlugin
+	var nextPlugins []*ReadyPlugin
+	nextLoaded := make(map[string]*loadedPlugin)
+
+	for _, file := range files {
+		current, isLoaded := m.loaded[file.path]
+		if isLoaded && !file.changedFrom(current.file) {
+			nextLoaded[file.path] = current
+			nextPlugins = append(nextPlugins, current.plugin)
+			continue
+		}
+		if failedFile, hasFailed := m.failed[file.path]; !isLoaded && hasFailed && !file.changedFrom(failedFile) {
+			continue
+		}
+
+		if isLoaded && file.kind == GoPlugin {
+			// Go runtime does not allow loading a plugin from the same path twice
+			m.logger.Warnf("Plugin %s has changed, but Go plugins cannot be reloaded in place. Copy the new "+
+				"version with a different file name to load it.", file.name)
+			current.file = file
+			nextLoaded[file.path] = current
+			nextPlugins = append(nextPlugins, current.plugin)
+			continue
+		}
+
+		if isLoaded {
+			m.logger.Infof("Plugin %s has changed, restarting it", file.name)
+		}
+		readyPlugin, loadErr := m.load(file)
+		if loadErr != nil && failOnPrepareErr {
+			return loadErr
+		}
+		if loadErr != nil || readyPlugin == nil {
+			m.failed[file.path] = file
+			if loadErr != nil {
+				m.logger.Errorf("Could not prepare plugin %s", file.name)
+				m.logger.Debug(loadErr)
+			}
+			// Keep the old version running if there is one. The new version is tried again when the file changes.
+			if isLoaded {
+				current.file = file
+				nextLoaded[file.path] = current
+				nextPlugins = append(nextPlugins, current.plugin)
+			}
+			continue
+		}
+
+		delete(m.failed, file.path)
+		if isLoaded {
+			toStop = append(toStop, current.plugin)
+		}
+		nextLoaded[file.path] = &loadedPlugin{
+			file:   file,
+			plugin: readyPlugin,
+		}
+		nextPlugins = append(nextPlugins, readyPlugin)
+	}
+
+	for path, current := range m.loaded {
+		if _, stillLoaded := nextLoaded[path]; !stillLoaded {
+			m.logger.Infof("Plugin %s has been removed or disabled, stopping it", current.file.name)
+			toStop = append(toStop, current.plugin)
+		}
+	}
+
+	changed := len(toStop) > 0 || len(nextLoaded) != len(m.loaded)
+	for path, next := range nextLoaded {
+		if current, ok := m.loaded[path]; !ok || current.plugin != next.plugin {
+			changed = true
+		}
+	}
+	m.loaded = nextLoaded
+
+	// The table is replaced, never modified, so the snapshots taken by WithPlugins stay valid
+	m.routingLock.Lock()
+	m.plugins = nextPlugins
+	m.routingLock.Unlock()
+
+	for _, plug := range toStop {
+		m.stopPlugin(plug)
+	}
+	if changed {
+		m.warnKeywordConflicts(nextPlugins)
+	}
+	return nil
+}
+
+// queueDepths returns the number of commands waiting in the queue of each plugin
+func (m *PluginManager) queueDepths() interface{} {
+	depths := make(map[string]map[string]int)
+	for _, plug := range m.Plugins() {
+		depths[plug.File] = map[string]int{
+			"depth":    len(plug.CommandChannel),
+			"capacity": cap(plug.CommandChannel),
+		}
+	}
+	return depths
+}
+
+// warnKeywordConflicts logs the command keywords and slash commands that are defined more than once. Messages that
+// match such keyword are not dispatched, but the user is asked which command was meant.
+func (m *PluginManager) warnKeywordConflicts(plugins []*ReadyPlugin) {
+	owners := make(map[string][]string)
+	slashOwners := make(map[string][]string)
+	var keywords, slashCommands []string
+	for _, plug := range plugins {
+		for _, cmd := range plug.AllCommands() {
+			keyword := strings.Join(strings.Fields(cmd.Keyword), " ")
+			if _, seen := owners[keyword]; !seen {
+				keywords = append(keywords, keyword)
+			}
+			owners[keyword] = append(owners[keyword], plug.File)
+			if cmd.SlashCommand == "" {
+				continue
+			}
+			if _, seen := slashOwners[cmd.SlashCommand]; !seen {
+				slashCommands = append(slashCommands, cmd.SlashCommand)
+			}
+			slashOwners[cmd.SlashCommand] = append(slashOwners[cmd.SlashCommand], plug.File)
+		}
+	}
+	for _, keyword := range keywords {
+		if len(owners[keyword]) > 1 {
+			m.logger.Warnf("Command keyword '%s' is defined more than once, in plugins %s", keyword,
+				strings.Join(owners[keyword], ", "))
+		}
+	}
+	for _, slashCommand := range slashCommands {
+		if len(slashOwners[slashCommand]) > 1 {
+			m.logger.Warnf("Slash command '%s' is defined more than once, in plugins %s", slashCommand,
+				strings.Join(slashOwners[slashCommand], ", "))
+		}
+	}
+}
+
+// Stopped is closed when all plugins have been stopped after the context of the bot is done.
+func (m *PluginManager) Stopped() <-chan struct{} {
+	return m.stopped
+}
+
+// stopPlugin stops the plugin in the background. The plugin is tracked until it is done, so that stopAll waits for
+// the plugins that were stopped by a reload or after a crash too.
+func (m *PluginManager) stopPlugin(plug *ReadyPlugin) {
+	m.stoppingLock.Lock()
+	m.stopping[plug] = struct{}{}
+	m.stoppingLock.Unlock()
+	go func() {
+		plug.shutdown()
+		<-plug.done
+		m.stoppingLock.Lock()
+		delete(m.stopping, plug)
+		m.stoppingLock.Unlock()
+	}()
+}
+
+// stopAll stops all plugins in parallel and waits until they are done, or until the grace period has passed. The
+// plugins that are still stopping after a reload or a crash are waited for as well. Executable plugins are killed
+// after the grace period, so they get a moment more to exit.
+func (m *PluginManager) stopAll() {
+	m.reloadLock.Lock()
+	defer m.reloadLock.Unlock()
+	defer close(m.stopped)
+
+	for _, plug := range m.Plugins() {
+		m.stopPlugin(plug)
+	}
+	m.stoppingLock.Lock()
+	plugins := make([]*ReadyPlugin, 0, len(m.stopping))
+	for plug := range m.stopping {
+		plugins = append(plugins, plug)
+	}
+	m.stoppingLock.Unlock()
+
+	timeout := time.NewTimer(m.gracePeriod + stopKillMargin)
+	defer timeout.Stop()
+	expired := false
+	var notStopped []string
+	for _, plug := range plugins {
+		if !expired {
+			select {
+			case <-plug.done:
+				continue
+			case <-timeout.C:
+				expired = true
+			}
+		}
+		select {
+		case <-plug.done:
+		default:
+			notStopped = append(notStopped, plug.File)
+		}
+	}
+
+	if len(notStopped) > 0 {
+		m.logger.Errorf("Plugins did not stop in %s: %s", m.gracePeriod, strings.Join(notStopped, ", "))
+		return
+	}
+	m.logger.Info("All plugins stopped")
+}
@@ -0,0 +1,312 @@
+package pluginloader
+
+import (
+	"errors"
+	"fmt"
+	"github.com/blissfulreboot/slagbot/internal/metrics"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"time"
+)
+
+const (
+	// A plugin whose queue has been full this long is considered stuck
+	pluginStuckTimeout  = 30 * time.Second
+	restartInitialDelay = time.Second
+	restartMaxDelay     = 5 * time.Minute
+	// A plugin that has been running longer than this before crashing is restarted without a delay
+	restartResetAfter = 10 * time.Minute
+	// Extra time given to the plugins on shutdown, so that the plugins killed after the grace period are done too
+	stopKillMargin = time.Second
+)
+
+// ErrPluginUnavailable is returned by Deliver when the plugin has crashed and has not been restarted or recovered yet.
+var ErrPluginUnavailable = errors.New("plugin is unavailable")
+
+// ErrPluginBusy is returned by Deliver when the queue of the plugin is full.
+var ErrPluginBusy = errors.New("plugin is busy")
+
+// Healthy is false after the plugin has crashed.
+func (p *ReadyPlugin) Healthy() bool {
+	p.healthLock.RLock()
+	defer p.healthLock.RUnlock()
+	return p.healthy
+}
+
+func (p *ReadyPlugin) setHealthy(healthy bool) {
+	p.healthLock.Lock()
+	defer p.healthLock.Unlock()
+	p.healthy = healthy
+}
+
+func (p *ReadyPlugin) reportCrash(reason string) {
+	select {
+	case p.crashed <- reason:
+	default:
+		// A crash has already been reported
+	}
+}
+
+// isStuck tells if the plugin has been marked crashed because its queue stayed full, and has not been restarted
+func (p *ReadyPlugin) isStuck() bool {
+	p.fullLock.Lock()
+	defer p.fullLock.Unlock()
+	return p.stuck
+}
+
+// recoverStuck delivers the command to a stuck plugin if its queue has room again, i.e. the plugin has started to
+// read its commands. The plugin is healthy again if the command was delivered.
+func (p *ReadyPlugin) recoverStuck(cmd types.ParsedCommand) bool {
+	p.fullLock.Lock()
+	defer p.fullLock.Unlock()
+	if !p.stuck {
+		return false
+	}
+	select {
+	case p.CommandChannel <- cmd:
+	default:
+		return false
+	}
+	p.stuck = false
+	p.fullSince = time.Time{}
+	p.setHealthy(true)
+	select {
+	case p.recovered <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Deliver queues the command to the plugin. If the queue is full, Deliver waits for the send timeout at most, so that
+// a slow plugin cannot block the command handling of the bot. A plugin whose queue stays full is considered crashed.
+// A crashed plugin that cannot be restarted is healthy again when there is room in its queue.
+func (p *ReadyPlugin) Deliver(cmd types.ParsedCommand) error {
+	if !p.Healthy() {
+		if p.recoverStuck(cmd) {
+			metrics.CommandsDelivered.Add(p.File, 1)
+			return nil
+		}
+		metrics.CommandsRejected.Add(p.File, 1)
+		return ErrPluginUnavailable
+	}
+
+	if p.sendTimeout <= 0 {
+		// Without a send timeout, the command is delivered only if there is room in the queue right away
+		select {
+		case p.CommandChannel <- cmd:
+			return p.delivered()
+		case <-p.stopped:
+			metrics.CommandsRejected.Add(p.File, 1)
+			return ErrPluginUnavailable
+		default:
+			return p.queueFull()
+		}
+	}
+
+	timer := time.NewTimer(p.sendTimeout)
+	defer timer.Stop()
+	select {
+	case p.CommandChannel <- cmd:
+		return p.delivered()
+	case <-p.stopped:
+		metrics.CommandsRejected.Add(p.File, 1)
+		return ErrPluginUnavailable
+	case <-timer.C:
+		return p.queueFull()
+	}
+}
+
+func (p *ReadyPlugin) delivered() error {
+	p.fullLock.Lock()
+	p.fullSince = time.Time{}
+	p.fullLock.Unlock()
+	metrics.CommandsDelivered.Add(p.File, 1)
+	return nil
+}
+
+// queueFull rejects a command that did not fit in the queue, and marks the plugin crashed if the queue has been full
+// too long
+func (p *ReadyPlugin) queueFull() error {
+	metrics.CommandsRejected.Add(p.File, 1)
+	p.fullLock.Lock()
+	defer p.fullLock.Unlock()
+	if p.fullSince.IsZero() {
+		p.fullSince = time.Now()
+	} else if time.Since(p.fullSince) > pluginStuckTimeout {
+		p.stuck = !p.restartable
+		p.setHealthy(false)
+		p.reportCrash(fmt.Sprintf("the queue of the plugin has been full for %s", time.Since(p.fullSince)))
+		return ErrPluginUnavailable
+	}
+	return ErrPluginBusy
+}
+
+// shutdown stops the plugin once and closes done when the stop function returns. Panics in the stop function of the
+// plugin are recovered.
+func (p *ReadyPlugin) shutdown() {
+	p.stopOnce.Do(func() {
+		close(p.stopped)
+		defer close(p.done)
+		defer func() {
+			recover()
+		}()
+		p.stop()
+	})
+}
+
+// start calls the run function of the plugin and supervises it until it is stopped.
+func (m *PluginManager) start(plug *ReadyPlugin, file pluginFile) {
+	plug.startedAt = time.Now()
+	plug.sendTimeout = m.queueTimeout
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				plug.reportCrash(fmt.Sprintf("panic in the run function: %v", r))
+			}
+		}()
+		plug.run(plug.CommandChannel, m.slackMessageChannel, m.logger)
+	}()
+	go m.supervise(plug, file)
+}
+
+func (m *PluginManager) supervise(plug *ReadyPlugin, file pluginFile) {
+	for {
+		var reason string
+		select {
+		case reason = <-plug.crashed:
+		case <-plug.stopped:
+			return
+		}
+
+		m.logger.Errorf("Plugin %s crashed: %s", plug.File, reason)
+		if plug.restartable {
+			plug.setHealthy(false)
+			m.restartCrashed(plug, file, reason)
+			return
+		}
+		if !plug.isStuck() {
+			plug.setHealthy(false)
+			m.notifyAdmin(fmt.Sprintf("Plugin `%s` crashed: %s\nThe plugin cannot be restarted, its commands are "+
+				"unavailable until the bot is restarted.", plug.File, reason))
+			return
+		}
+
+		// A stuck plugin that cannot be restarted may still catch up with its queue
+		m.notifyAdmin(fmt.Sprintf("Plugin `%s` crashed: %s\nThe plugin cannot be restarted, its commands are "+
+			"unavailable until it reads its queue again.", plug.File, reason))
+		select {
+		case <-plug.recovered:
+		case <-plug.stopped:
+			return
+		}
+		m.logger.Infof("Plugin %s reads its queue again", plug.File)
+		m.notifyAdmin(fmt.Sprintf("Plugin `%s` reads its queue again, its commands are available.", plug.File))
+	}
+}
+
+// restartCrashed stops the crashed plugin and restarts it with an increasing delay until the restart succeeds. The
+// replacement is started only after the crashed plugin has exited or has been killed.
+func (m *PluginManager) restartCrashed(plug *ReadyPlugin, file pluginFile, reason string) {
+	m.stopPlugin(plug)
+	stopTimeout := time.NewTimer(m.gracePeriod + stopKillMargin)
+	select {
+	case <-plug.done:
+		stopTimeout.Stop()
+	case <-stopTimeout.C:
+		m.logger.Errorf("Crashed plugin %s did not exit in %s after it was killed", plug.File, stopKillMargin)
+	case <-m.ctx.Done():
+		stopTimeout.Stop()
+		return
+	}
+
+	m.restartLock.Lock()
+	attempt := m.restarts[file.path]
+	if time.Since(plug.startedAt) > restartResetAfter {
+		attempt = 0
+	}
+	m.restartLock.Unlock()
+	m.notifyAdmin(fmt.Sprintf("Plugin `%s` crashed: %s\nRestarting it in %s.", plug.File, reason,
+		restartDelay(attempt)))
+
+	for {
+		m.restartLock.Lock()
+		m.restarts[file.path] = attempt + 1
+		m.restartLock.Unlock()
+
+		select {
+		case <-time.After(restartDelay(attempt)):
+		case <-m.ctx.Done():
+			return
+		}
+		if m.restart(plug, file) {
+			return
+		}
+		attempt++
+		m.logger.Errorf("Could not restart plugin %s, trying again in %s", plug.File, restartDelay(attempt))
+	}
+}
+
+// restartDelay doubles the delay for every consecutive crash
+func restartDelay(attempt int) time.Duration {
+	delay := restartInitialDelay
+	for i := 0; i < attempt && delay < restartMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > restartMaxDelay {
+		delay = restartMaxDelay
+	}
+	return delay
+}
+
+// restart loads the plugin again and replaces the crashed plugin in the routing table. Nothing is done if the plugin
+// has been reloaded or removed in the meantime. False is returned if the plugin should be tried again later.
+func (m *PluginManager) restart(crashed *ReadyPlugin, file pluginFile) bool {
+	m.reloadLock.Lock()
+	defer m.reloadLock.Unlock()
+
+	current, isLoaded := m.loaded[file.path]
+	if !isLoaded || current.plugin != crashed || m.ctx.Err() != nil {
+		return true
+	}
+
+	m.logger.Infof("Restarting plugin %s", crashed.File)
+	restarted, loadErr := m.load(current.file)
+	if loadErr != nil {
+		m.logger.Debug(loadErr)
+	}
+	if restarted == nil {
+		return false
+	}
+
+	m.loaded[file.path] = &loadedPlugin{
+		file:   current.file,
+		plugin: restarted,
+	}
+	m.routingLock.Lock()
+	nextPlugins := make([]*ReadyPlugin, len(m.plugins))
+	for i, plug := range m.plugins {
+		if plug == crashed {
+			plug = restarted
+		}
+		nextPlugins[i] = plug
+	}
+	m.plugins = nextPlugins
+	m.routingLock.Unlock()
+
+	m.notifyAdmin(fmt.Sprintf("Plugin `%s` has been restarted.", crashed.File))
+	return true
+}
+
+// notifyAdmin posts the message to the admin channel if one is configured
+func (m *PluginManager) notifyAdmin(message string) {
+	if m.adminChannel == "" {
+		return
+	}
+	select {
+	case m.slackMessageChannel <- types.OutgoingSlackMessage{
+		Channel:  m.adminChannel,
+		Message:  message,
+		Priority: types.HighPriority,
+	}:
+	case <-m.ctx.Done():
+	}
+}
@@ -0,0 +1,92 @@
+package pluginloader
+
+import (
+	"errors"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"testing"
+	"time"
+)
+
+func newTestPlugin(restartable bool) *ReadyPlugin {
+	return &ReadyPlugin{
+		File:           "test.plugin",
+		CommandChannel: make(chan types.ParsedCommand, 1),
+		restartable:    restartable,
+		crashed:        make(chan string, 1),
+		recovered:      make(chan struct{}, 1),
+		stopped:        make(chan struct{}),
+		done:           make(chan struct{}),
+		healthy:        true,
+		sendTimeout:    time.Millisecond,
+	}
+}
+
+// makeStuck fills the queue of the plugin and delivers until the plugin is considered crashed
+func makeStuck(t *testing.T, plug *ReadyPlugin) {
+	plug.CommandChannel <- types.ParsedCommand{}
+	if err := plug.Deliver(types.ParsedCommand{}); !errors.Is(err, ErrPluginBusy) {
+		t.Fatalf("Deliver to a full queue = %v, want ErrPluginBusy", err)
+	}
+	plug.fullLock.Lock()
+	plug.fullSince = time.Now().Add(-pluginStuckTimeout - time.Second)
+	plug.fullLock.Unlock()
+	if err := plug.Deliver(types.ParsedCommand{}); !errors.Is(err, ErrPluginUnavailable) {
+		t.Fatalf("Deliver to a stuck queue = %v, want ErrPluginUnavailable", err)
+	}
+	select {
+	case <-plug.crashed:
+	default:
+		t.Fatal("the stuck plugin did not report a crash")
+	}
+}
+
+func TestDeliverRecoversStuckPlugin(t *testing.T) {
+	plug := newTestPlugin(false)
+	makeStuck(t, plug)
+
+	if err := plug.Deliver(types.ParsedCommand{}); !errors.Is(err, ErrPluginUnavailable) {
+		t.Fatalf("Deliver while the queue is still full = %v, want ErrPluginUnavailable", err)
+	}
+
+	<-plug.CommandChannel
+	if err := plug.Deliver(types.ParsedCommand{Command: "next"}); err != nil {
+		t.Fatalf("Deliver after the plugin read its queue = %v, want nil", err)
+	}
+	if !plug.Healthy() {
+		t.Error("the plugin is not healthy after reading its queue")
+	}
+	if cmd := <-plug.CommandChannel; cmd.Command != "next" {
+		t.Errorf("delivered command = %q, want %q", cmd.Command, "next")
+	}
+	select {
+	case <-plug.recovered:
+	default:
+		t.Error("the recovery was not signalled")
+	}
+}
+
+func TestDeliverDoesNotRecoverRestartablePlugin(t *testing.T) {
+	plug := newTestPlugin(true)
+	makeStuck(t, plug)
+
+	<-plug.CommandChannel
+	if err := plug.Deliver(types.ParsedCommand{}); !errors.Is(err, ErrPluginUnavailable) {
+		t.Fatalf("Deliver to a crashed restartable plugin = %v, want ErrPluginUnavailable", err)
+	}
+}
+
+func TestDeliverWithoutTimeout(t *testing.T) {
+	plug := newTestPlugin(false)
+	plug.sendTimeout = 0
+	for i := 0; i < 1000; i++ {
+		if err := plug.Deliver(types.ParsedCommand{}); err != nil {
+			t.Fatalf("Deliver %d to an empty queue without a timeout = %v, want nil", i+1, err)
+		}
+		<-plug.CommandChannel
+	}
+
+	plug.CommandChannel <- types.ParsedCommand{}
+	if err := plug.Deliver(types.ParsedCommand{}); !errors.Is(err, ErrPluginBusy) {
+		t.Errorf("Deliver to a full queue without a timeout = %v, want ErrPluginBusy", err)
+	}
+}
@@ -0,0 +1,41 @@
+package slackconnection
+
+import (
+	"sync"
+	"time"
+)
+
+const recentMessageTTL = time.Minute
+
+// recentMessages remembers the messages received lately. Slack sends both app_mention and message events when the
+// bot is mentioned in a channel, and only the first one should be handled.
+type recentMessages struct {
+	lock     sync.Mutex
+	messages map[string]time.Time
+}
+
+func newRecentMessages() *recentMessages {
+	return &recentMessages{
+		messages: make(map[string]time.Time),
+	}
+}
+
+// seen marks the message as received and returns true if it had already been received.
+func (r *recentMessages) seen(channel string, timestamp string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	for key, received := range r.messages {
+		if now.Sub(received) > recentMessageTTL {
+			delete(r.messages, key)
+		}
+	}
+
+	key := channel + "/" + timestamp
+	if _, ok := r.messages[key]; ok {
+		return true
+	}
+	r.messages[key] = now
+	return false
+}
@@ -0,0 +1,59 @@
+package slackconnection
+
+import (
+	"github.com/slack-go/slack/slackevents"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestReceiveMessageDeduplicatesMentions(t *testing.T) {
+	mention := &slackevents.AppMentionEvent{User: "U1", Text: "<@UBOT> deploy", Channel: "C1", TimeStamp: "1.1"}
+	message := &slackevents.MessageEvent{User: "U1", Text: "<@UBOT> deploy", Channel: "C1", TimeStamp: "1.1"}
+	tests := []struct {
+		name   string
+		events []interface{}
+	}{
+		{name: "app_mention first", events: []interface{}{mention, message}},
+		{name: "message first", events: []interface{}{message, mention}},
+	}
+	for _, test := range tests {
+		b := &Bot{slackbotSelfId: "UBOT", recentMessages: newRecentMessages(), logger: zap.NewNop().Sugar()}
+		var received []SlackMessage
+		for _, event := range test.events {
+			if msg, ok := b.receiveMessage(event); ok {
+				received = append(received, msg)
+			}
+		}
+		if len(received) != 1 {
+			t.Errorf("%s: received %d messages, want 1", test.name, len(received))
+			continue
+		}
+		if msg := received[0]; !msg.Mentioned || msg.Text != "deploy" {
+			t.Errorf("%s: received %+v, want a mention with the text \"deploy\"", test.name, msg)
+		}
+	}
+}
+
+func TestReceiveMessage(t *testing.T) {
+	b := &Bot{slackbotSelfId: "UBOT", recentMessages: newRecentMessages(), logger: zap.NewNop().Sugar()}
+	tests := []struct {
+		name  string
+		event interface{}
+		want  bool
+	}{
+		{name: "message", event: &slackevents.MessageEvent{User: "U1", Channel: "C1", TimeStamp: "1.1"}, want: true},
+		{
+			name:  "same ts in another channel",
+			event: &slackevents.MessageEvent{User: "U1", Channel: "C2", TimeStamp: "1.1"},
+			want:  true,
+		},
+		{name: "repeated", event: &slackevents.MessageEvent{User: "U1", Channel: "C1", TimeStamp: "1.1"}},
+		{name: "own message", event: &slackevents.MessageEvent{User: "UBOT", Channel: "C1", TimeStamp: "1.2"}},
+		{name: "unknown event", event: &slackevents.ReactionAddedEvent{}},
+	}
+	for _, test := range tests {
+		if _, ok := b.receiveMessage(test.event); ok != test.want {
+			t.Errorf("%s: receiveMessage = %t, want %t", test.name, ok, test.want)
+		}
+	}
+}
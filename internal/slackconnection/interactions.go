@@ -0,0 +1,146 @@
+package slackconnection
+
+import (
+	"errors"
+	"github.com/blissfulreboot/slagbot/internal/metrics"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
+)
+
+// The interactions are buffered, so that a burst of clicks does not hold up the other events
+const interactionQueueSize = 32
+
+// SlackInteraction is a click of an interactive element or a submission of a modal
+type SlackInteraction struct {
+	User             string
+	Channel          string
+	MessageTimestamp string
+	ThreadTimestamp  string
+	Interaction      types.Interaction
+}
+
+// actionValue returns the value of the action whichever element it came from, and the values of a multi-select.
+func actionValue(action slack.BlockAction) (string, []string) {
+	var selected []string
+	for _, option := range action.SelectedOptions {
+		selected = append(selected, option.Value)
+	}
+	selected = append(selected, action.SelectedUsers...)
+	selected = append(selected, action.SelectedChannels...)
+	selected = append(selected, action.SelectedConversations...)
+
+	for _, value := range []string{action.Value, action.SelectedOption.Value, action.SelectedUser,
+		action.SelectedChannel, action.SelectedConversation, action.SelectedDate, action.SelectedTime} {
+		if value != "" {
+			return value, selected
+		}
+	}
+	return "", selected
+}
+
+// viewValues returns the values of the inputs of a modal keyed by the action id of the input element
+func viewValues(state *slack.ViewState) map[string]string {
+	values := make(map[string]string)
+	if state == nil {
+		return values
+	}
+	for _, actions := range state.Values {
+		for actionID, action := range actions {
+			value, selected := actionValue(action)
+			if value == "" && len(selected) > 0 {
+				value = selected[0]
+			}
+			values[actionID] = value
+		}
+	}
+	return values
+}
+
+func (b *Bot) interactionHandler(evt *socketmode.Event, client *socketmode.Client) {
+	callback, ok := evt.Data.(slack.InteractionCallback)
+	if !ok {
+		b.logger.Debugf("> Ignored %+v", evt)
+		return
+	}
+	// Acknowledge immediately, Slack shows an error to the user if there is no response within 3 seconds
+	client.Ack(*evt.Request)
+	b.logger.Debugf("InteractionCallback: %+v", callback)
+
+	channel := callback.Container.ChannelID
+	if channel == "" {
+		channel = callback.Channel.ID
+	}
+	switch callback.Type {
+	case slack.InteractionTypeBlockActions:
+		for _, action := range callback.ActionCallback.BlockActions {
+			value, selected := actionValue(*action)
+			b.queueInteraction(SlackInteraction{
+				User:             callback.User.ID,
+				Channel:          channel,
+				MessageTimestamp: callback.Container.MessageTs,
+				ThreadTimestamp:  callback.Container.ThreadTs,
+				Interaction: types.Interaction{
+					Type:           types.BlockAction,
+					ActionID:       action.ActionID,
+					BlockID:        action.BlockID,
+					Value:          value,
+					SelectedValues: selected,
+					ViewID:         callback.View.ID,
+					TriggerID:      callback.TriggerID,
+					ResponseURL:    callback.ResponseURL,
+				},
+			})
+		}
+	case slack.InteractionTypeViewSubmission, slack.InteractionTypeViewClosed:
+		interactionType := types.ViewSubmission
+		if callback.Type == slack.InteractionTypeViewClosed {
+			interactionType = types.ViewClosed
+		}
+		b.queueInteraction(SlackInteraction{
+			User: callback.User.ID,
+			Interaction: types.Interaction{
+				Type:            interactionType,
+				CallbackID:      callback.View.CallbackID,
+				ViewID:          callback.View.ID,
+				PrivateMetadata: callback.View.PrivateMetadata,
+				Values:          viewValues(callback.View.State),
+				TriggerID:       callback.TriggerID,
+			},
+		})
+	default:
+		b.logger.Debugf("Ignoring interaction of type %s", callback.Type)
+	}
+}
+
+// queueInteraction passes the interaction to the command handler, unless the bot is stopping. The interaction is
+// dropped if the queue is full, since waiting would hold up all the other events from Slack.
+func (b *Bot) queueInteraction(interaction SlackInteraction) {
+	select {
+	case <-b.done:
+		b.logger.Debugf("Bot is stopping, ignoring the interaction %s", interaction.Interaction.ID())
+		return
+	default:
+	}
+	select {
+	case b.InteractionChannel <- interaction:
+	default:
+		b.logger.Errorf("The interaction queue is full, dropped the interaction %s of user %s",
+			interaction.Interaction.ID(), interaction.User)
+		metrics.InteractionsDropped.Add(1)
+	}
+}
+
+// openView opens the modal of the message
+func (b *Bot) openView(msg types.OutgoingSlackMessage) error {
+	if msg.TriggerID == "" {
+		b.logger.Error("Cannot open a view without a trigger id")
+		return errors.New("a trigger id is required for opening a view")
+	}
+	if _, err := b.client.OpenView(msg.TriggerID, *msg.View); err != nil {
+		b.logger.Errorf("failed opening view: %v", err)
+		b.logger.Debugf("View: %+v", msg.View)
+		return err
+	}
+	return nil
+}
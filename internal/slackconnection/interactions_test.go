@@ -0,0 +1,41 @@
+package slackconnection
+
+import (
+	"github.com/blissfulreboot/slagbot/internal/metrics"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestQueueInteractionDropsWhenFull(t *testing.T) {
+	b := &Bot{
+		InteractionChannel: make(chan SlackInteraction, 1),
+		done:               make(chan struct{}),
+		logger:             zap.NewNop().Sugar(),
+	}
+	droppedBefore := metrics.InteractionsDropped.Value()
+
+	queued := make(chan struct{})
+	go func() {
+		for _, actionID := range []string{"first", "second"} {
+			b.queueInteraction(SlackInteraction{
+				User:        "U1",
+				Interaction: types.Interaction{Type: types.BlockAction, ActionID: actionID},
+			})
+		}
+		close(queued)
+	}()
+	select {
+	case <-queued:
+	case <-time.After(5 * time.Second):
+		t.Fatal("queueInteraction blocked on a full queue")
+	}
+
+	if got := (<-b.InteractionChannel).Interaction.ActionID; got != "first" {
+		t.Errorf("the queued interaction is %s, want first", got)
+	}
+	if dropped := metrics.InteractionsDropped.Value() - droppedBefore; dropped != 1 {
+		t.Errorf("%d interactions were counted as dropped, want 1", dropped)
+	}
+}
@@ -0,0 +1,205 @@
+package slackconnection
+
+import (
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"github.com/slack-go/slack"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+Slack truncates messages that are longer than 40 000 characters and recommends keeping them under 4 000. Long
+messages are split into several messages before they are queued, or uploaded as a file if they are longer than the
+upload threshold.
+*/
+
+const (
+	defaultFileName = "message.txt"
+	codeFence       = "```"
+	// maxLanguageLength is the longest language tag after an opening fence that is repeated when the block is opened
+	// again. Longer text after a fence is code.
+	maxLanguageLength = 20
+	// maxResponseParts is the number of times the response url of a slash command can be used
+	maxResponseParts = 5
+	truncatedNote    = "\n_(The message was too long and was truncated)_"
+)
+
+// prepareMessage splits a long message into several messages, or turns it into a file upload. The Result of the
+// message is given to the first part and the attachments to the last one.
+func (b *Bot) prepareMessage(msg types.OutgoingSlackMessage) []types.OutgoingSlackMessage {
+	if msg.Operation != "" && msg.Operation != types.PostMessage && msg.Operation != types.PostEphemeral {
+		return []types.OutgoingSlackMessage{msg}
+	}
+	// With blocks, the text is only shown in the notifications
+	if msg.View != nil || (msg.Blocks != nil && len(msg.Blocks.BlockSet) > 0) {
+		return []types.OutgoingSlackMessage{msg}
+	}
+
+	length := utf8.RuneCountInString(msg.Message)
+	// Ephemeral messages and the replies to slash commands cannot have files
+	if b.uploadLength > 0 && length > b.uploadLength && msg.Operation != types.PostEphemeral && msg.ResponseURL == "" {
+		msg.Operation = types.UploadFile
+		return []types.OutgoingSlackMessage{msg}
+	}
+
+	parts := splitMessage(msg.Message, b.splitLength)
+	if len(parts) == 1 {
+		return []types.OutgoingSlackMessage{msg}
+	}
+	if msg.ResponseURL != "" && len(parts) > maxResponseParts {
+		b.logger.Warnf("The reply to a slash command needs %d messages but the response url can be used only %d "+
+			"times, the reply was truncated", len(parts), maxResponseParts)
+		limit := b.splitLength - utf8.RuneCountInString(truncatedNote)
+		if limit < 1 {
+			limit = 1
+		}
+		parts = splitMessage(msg.Message, limit)
+		if len(parts) > maxResponseParts {
+			parts = parts[:maxResponseParts]
+		}
+		parts[len(parts)-1] += truncatedNote
+	}
+	messages := make([]types.OutgoingSlackMessage, len(parts))
+	for i, part := range parts {
+		messages[i] = msg
+		messages[i].Message = part
+		if i > 0 {
+			messages[i].Result = nil
+		}
+		if i < len(parts)-1 {
+			messages[i].Attachments = nil
+		}
+	}
+	return messages
+}
+
+// splitMessage splits the text into parts of at most limit characters on line boundaries. Lines longer than the limit
+// are split between words. A code block that continues in the next part is closed at the end of the part and opened
+// again, with its language tag, at the start of the next one.
+func splitMessage(text string, limit int) []string {
+	if limit <= 0 || utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+	lines := strings.Split(text, "\n")
+	// Room for a fence and a newline at both ends of a part
+	fenceLength := len(codeFence) + 1
+	for _, line := range lines {
+		if length := len(codeFence) + 1 + utf8.RuneCountInString(fenceLanguage(line)); length > fenceLength {
+			fenceLength = length
+		}
+	}
+	lineLimit := limit - 2*fenceLength
+	if lineLimit < 1 {
+		lineLimit = 1
+	}
+
+	var parts []string
+	var current []string
+	currentLength := 0
+	inFence := false
+	opening := codeFence
+	for _, line := range lines {
+		language := fenceLanguage(line)
+		for _, piece := range splitLine(line, lineLimit) {
+			pieceLength := utf8.RuneCountInString(piece)
+			fenceAfter := inFence != (strings.Count(piece, codeFence)%2 == 1)
+			needed := currentLength + pieceLength
+			if len(current) > 0 {
+				needed++
+			}
+			if fenceAfter {
+				needed += len(codeFence) + 1
+			}
+
+			if needed > limit && len(current) > 0 {
+				part := strings.Join(current, "\n")
+				current = nil
+				currentLength = 0
+				if inFence {
+					part += "\n" + codeFence
+					current = []string{opening}
+					currentLength = utf8.RuneCountInString(opening)
+				}
+				parts = append(parts, part)
+			}
+
+			// The break between the parts replaces an empty line, and Slack does not post empty messages
+			if len(current) == 0 && piece == "" {
+				continue
+			}
+			if len(current) > 0 {
+				currentLength++
+			}
+			current = append(current, piece)
+			currentLength += pieceLength
+			if fenceAfter && strings.Contains(piece, codeFence) {
+				opening = codeFence + language
+			}
+			inFence = fenceAfter
+		}
+	}
+	if len(current) > 0 {
+		parts = append(parts, strings.Join(current, "\n"))
+	}
+	return parts
+}
+
+// fenceLanguage returns the language tag of a line that opens a code block with the tag, like ```go
+func fenceLanguage(line string) string {
+	if !strings.HasPrefix(line, codeFence) {
+		return ""
+	}
+	language := line[len(codeFence):]
+	if language == "" || utf8.RuneCountInString(language) > maxLanguageLength ||
+		strings.ContainsAny(language, " \t`") {
+		return ""
+	}
+	return language
+}
+
+// splitLine splits the line into pieces of at most limit characters, at the last space if there is one in the second
+// half of the piece. A piece never ends in the middle of a run of backticks, so that a fence is not cut in two.
+func splitLine(line string, limit int) []string {
+	var pieces []string
+	runes := []rune(line)
+	for len(runes) > limit {
+		cut := limit
+		for i := limit; i > limit/2; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		start := cut
+		for start > 0 && runes[start-1] == '`' && runes[start] == '`' {
+			start--
+		}
+		if start > 0 {
+			cut = start
+		}
+		pieces = append(pieces, string(runes[:cut]))
+		runes = runes[cut:]
+		if len(runes) > 0 && runes[0] == ' ' {
+			runes = runes[1:]
+		}
+	}
+	return append(pieces, string(runes))
+}
+
+// uploadFile uploads the text of the message as a file. The file is shared to the channel asynchronously, so the ts
+// of the file message is not known.
+func (b *Bot) uploadFile(channelId string, msg types.OutgoingSlackMessage) (types.OutgoingResult, error) {
+	fileName := msg.FileName
+	if fileName == "" {
+		fileName = defaultFileName
+	}
+	_, err := b.client.UploadFileV2(slack.UploadFileV2Parameters{
+		Content:         msg.Message,
+		FileSize:        len(msg.Message),
+		Filename:        fileName,
+		Title:           fileName,
+		Channel:         channelId,
+		ThreadTimestamp: msg.ThreadTimestamp,
+	})
+	return types.OutgoingResult{Channel: channelId}, err
+}
@@ -0,0 +1,170 @@
+package slackconnection
+
+import (
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"go.uber.org/zap"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// checkParts checks that the parts are within the limit and that every part has balanced code fences
+func checkParts(t *testing.T, name string, parts []string, limit int) {
+	t.Helper()
+	for i, part := range parts {
+		if length := utf8.RuneCountInString(part); length > limit {
+			t.Errorf("%s: part %d has %d characters, the limit is %d", name, i+1, length, limit)
+		}
+		if strings.Count(part, codeFence)%2 != 0 {
+			t.Errorf("%s: part %d has unbalanced code fences: %q", name, i+1, part)
+		}
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	longWords := strings.Repeat("word ", 30)
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{name: "short", text: "hello\nworld", limit: 20, want: []string{"hello\nworld"}},
+		{name: "disabled", text: longWords, limit: 0, want: []string{longWords}},
+		{
+			name:  "empty line at the break",
+			text:  "0123456789\n0123456789\n\nabc",
+			limit: 21,
+			want:  []string{"0123456789\n0123456789", "abc"},
+		},
+		{name: "exactly the limit", text: "0123456789", limit: 10, want: []string{"0123456789"}},
+		{
+			name:  "lines",
+			text:  "first line\nsecond line\nthird line",
+			limit: 22,
+			want:  []string{"first line\nsecond line", "third line"},
+		},
+		{
+			name:  "multibyte",
+			text:  "äääää\nööööö\nååååå",
+			limit: 13,
+			want:  []string{"äääää\nööööö", "ååååå"},
+		},
+		{
+			name:  "long line between words",
+			text:  "aaaa bbbb cccc dddd eeee ffff",
+			limit: 19,
+			want:  []string{"aaaa bbbb\ncccc dddd", "eeee ffff"},
+		},
+		{
+			name:  "code block",
+			text:  "```\nline 1\nline 2\nline 3\n```",
+			limit: 21,
+			want:  []string{"```\nline 1\nline 2\n```", "```\nline 3\n```"},
+		},
+		{
+			name:  "language tag",
+			text:  "```go\nline 1\nline 2\nline 3\n```",
+			limit: 23,
+			want:  []string{"```go\nline 1\nline 2\n```", "```go\nline 3\n```"},
+		},
+		{
+			name:  "text after a fence that is not a language tag",
+			text:  "```x = 1\nline 2\nline 3\n```",
+			limit: 20,
+			want:  []string{"```x = 1\nline 2\n```", "```\nline 3\n```"},
+		},
+	}
+	for _, test := range tests {
+		got := splitMessage(test.text, test.limit)
+		if strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Errorf("%s: splitMessage = %q, want %q", test.name, got, test.want)
+		}
+		if test.limit > 0 {
+			checkParts(t, test.name, got, test.limit)
+		}
+	}
+}
+
+func TestSplitMessageKeepsFencesBalanced(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+	}{
+		{name: "inline fence on a long line", text: strings.Repeat("see ```code``` and ", 20), limit: 40},
+		{name: "fence at the cut", text: strings.Repeat("x", 14) + "```" + strings.Repeat("y", 30) + "```", limit: 23},
+		{name: "long code block", text: "```\n" + strings.Repeat("some code here\n", 50) + "```", limit: 50},
+		{name: "long language tag", text: "```javascript\n" + strings.Repeat("let a = 1;\n", 30) + "```", limit: 40},
+		{
+			name:  "fences on a long line",
+			text:  "```abcdef```ghi```go\n" + strings.Repeat("code\n", 10) + "```",
+			limit: 23,
+		},
+		{name: "multibyte code", text: "```\n" + strings.Repeat("äöå ", 100) + "\n```", limit: 30},
+	}
+	for _, test := range tests {
+		parts := splitMessage(test.text, test.limit)
+		if len(parts) < 2 {
+			t.Errorf("%s: the text was not split", test.name)
+		}
+		checkParts(t, test.name, parts, test.limit)
+	}
+}
+
+func TestSplitLine(t *testing.T) {
+	tests := []struct {
+		line  string
+		limit int
+		want  []string
+	}{
+		{line: "short", limit: 10, want: []string{"short"}},
+		{line: "aaaa bbbb cccc", limit: 10, want: []string{"aaaa bbbb", "cccc"}},
+		{line: "aaaaaaaaaaaaaaa", limit: 10, want: []string{"aaaaaaaaaa", "aaaaa"}},
+		{line: "ääääääääääääää", limit: 10, want: []string{"ääääääääää", "ääää"}},
+		{line: "aaaaaaaa```bbbbbb", limit: 10, want: []string{"aaaaaaaa", "```bbbbbb"}},
+	}
+	for _, test := range tests {
+		got := splitLine(test.line, test.limit)
+		if strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Errorf("splitLine(%q, %d) = %q, want %q", test.line, test.limit, got, test.want)
+		}
+	}
+}
+
+func TestPrepareMessage(t *testing.T) {
+	bot := &Bot{splitLength: 21, uploadLength: 100, logger: zap.NewNop().Sugar()}
+	text := strings.Repeat("0123456789\n", 20)
+	tests := []struct {
+		name      string
+		msg       types.OutgoingSlackMessage
+		parts     int
+		operation types.OutgoingOperation
+	}{
+		{name: "short", msg: types.OutgoingSlackMessage{Message: "hello"}, parts: 1},
+		{name: "split", msg: types.OutgoingSlackMessage{Message: text[:66]}, parts: 3},
+		{name: "upload", msg: types.OutgoingSlackMessage{Message: text}, parts: 1, operation: types.UploadFile},
+		{name: "response url", msg: types.OutgoingSlackMessage{Message: text, ResponseURL: "https://x"}, parts: 5},
+		{
+			name:      "ephemeral",
+			msg:       types.OutgoingSlackMessage{Message: text, Operation: types.PostEphemeral},
+			parts:     10,
+			operation: types.PostEphemeral,
+		},
+	}
+	for _, test := range tests {
+		messages := bot.prepareMessage(test.msg)
+		if len(messages) != test.parts {
+			t.Errorf("%s: %d messages, want %d", test.name, len(messages), test.parts)
+			continue
+		}
+		if messages[0].Operation != test.operation {
+			t.Errorf("%s: operation %q, want %q", test.name, messages[0].Operation, test.operation)
+		}
+	}
+
+	messages := bot.prepareMessage(types.OutgoingSlackMessage{Message: text, ResponseURL: "https://x"})
+	if last := messages[len(messages)-1].Message; !strings.HasSuffix(last, truncatedNote) {
+		t.Errorf("the last part of a truncated reply is %q, want the note about the truncation", last)
+	}
+}
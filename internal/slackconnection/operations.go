@@ -0,0 +1,67 @@
+package slackconnection
+
+import (
+	"errors"
+	"fmt"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"github.com/slack-go/slack"
+)
+
+// operationName is used in the log messages
+func operationName(operation types.OutgoingOperation) string {
+	switch operation {
+	case "", types.PostMessage:
+		return "post"
+	case types.PostEphemeral:
+		return "post ephemeral"
+	case types.UpdateMessage:
+		return "update"
+	case types.DeleteMessage:
+		return "delete"
+	case types.AddReaction:
+		return "add reaction to"
+	case types.RemoveReaction:
+		return "remove reaction from"
+	case types.UploadFile:
+		return "upload"
+	default:
+		return string(operation)
+	}
+}
+
+// runOperation does the operation of the message in the channel. For reactions, the result is the reacted message.
+func (b *Bot) runOperation(channelId string, msg types.OutgoingSlackMessage) (types.OutgoingResult, error) {
+	if msg.Operation != "" && msg.Operation != types.PostMessage && msg.Operation != types.PostEphemeral &&
+		msg.Operation != types.UploadFile && msg.Timestamp == "" {
+		return types.OutgoingResult{}, errors.New(fmt.Sprintf("the ts of the message is required for %s",
+			msg.Operation))
+	}
+
+	switch msg.Operation {
+	case "", types.PostMessage:
+		channel, timestamp, err := b.client.PostMessage(channelId, messageOptions(msg)...)
+		return types.OutgoingResult{Channel: channel, Timestamp: timestamp}, err
+	case types.PostEphemeral:
+		if msg.User == "" {
+			return types.OutgoingResult{}, errors.New("the user is required for an ephemeral message")
+		}
+		timestamp, err := b.client.PostEphemeral(channelId, msg.User, messageOptions(msg)...)
+		return types.OutgoingResult{Channel: channelId, Timestamp: timestamp}, err
+	case types.UpdateMessage:
+		channel, timestamp, _, err := b.client.UpdateMessage(channelId, msg.Timestamp, messageOptions(msg)...)
+		return types.OutgoingResult{Channel: channel, Timestamp: timestamp}, err
+	case types.DeleteMessage:
+		channel, timestamp, err := b.client.DeleteMessage(channelId, msg.Timestamp)
+		return types.OutgoingResult{Channel: channel, Timestamp: timestamp}, err
+	case types.AddReaction:
+		err := b.client.AddReaction(msg.Reaction, slack.NewRefToMessage(channelId, msg.Timestamp))
+		return types.OutgoingResult{Channel: channelId, Timestamp: msg.Timestamp}, err
+	case types.RemoveReaction:
+		err := b.client.RemoveReaction(msg.Reaction, slack.NewRefToMessage(channelId, msg.Timestamp))
+		return types.OutgoingResult{Channel: channelId, Timestamp: msg.Timestamp}, err
+	case types.UploadFile:
+		return b.uploadFile(channelId, msg)
+	default:
+		return types.OutgoingResult{}, errors.New(fmt.Sprintf("unknown operation '%s'", msg.Operation))
+	}
+}
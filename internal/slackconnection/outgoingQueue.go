@@ -0,0 +1,205 @@
+package slackconnection
+
+import (
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"time"
+)
+
+/*
+The outgoing messages are queued before they are sent, so that the plugins are not blocked by the rate limits of
+Slack. Each channel has a token bucket that allows a short burst and then about one message per interval, which is
+the limit of chat.postMessage. When Slack still responds with a rate limit error, all sending is paused for the time
+given in the Retry-After header and the message is retried.
+*/
+
+type queuedMessage struct {
+	msg      types.OutgoingSlackMessage
+	seq      uint64
+	attempts uint
+}
+
+// key identifies the rate limit bucket of the message. Modals and replies to slash commands are not limited.
+func (q *queuedMessage) key() string {
+	if q.msg.View != nil || q.msg.ResponseURL != "" {
+		return ""
+	}
+	if q.msg.Channel != "" {
+		return q.msg.Channel
+	}
+	return "email:" + q.msg.UserEmail
+}
+
+func priorityRank(priority types.MessagePriority) int {
+	switch priority {
+	case types.LowPriority:
+		return 0
+	case types.HighPriority:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// outgoingQueue is a queue that returns the messages in the order of priority and arrival. The size of zero means that
+// the queue is not bounded.
+type outgoingQueue struct {
+	size     int
+	messages []*queuedMessage
+	nextSeq  uint64
+}
+
+func newOutgoingQueue(size uint) *outgoingQueue {
+	return &outgoingQueue{size: int(size)}
+}
+
+func (q *outgoingQueue) len() int {
+	return len(q.messages)
+}
+
+// push adds the message to the queue. If the queue is full, the newest message of the lowest priority is dropped,
+// which may be the pushed message itself. The dropped message is returned.
+func (q *outgoingQueue) push(msg types.OutgoingSlackMessage) *queuedMessage {
+	q.nextSeq++
+	item := &queuedMessage{msg: msg, seq: q.nextSeq}
+	if q.size == 0 || len(q.messages) < q.size {
+		q.messages = append(q.messages, item)
+		return nil
+	}
+	victim := -1
+	for i, queued := range q.messages {
+		if victim == -1 || isBefore(q.messages[victim], queued) {
+			victim = i
+		}
+	}
+	if victim == -1 || !isBefore(item, q.messages[victim]) {
+		return item
+	}
+	dropped := q.messages[victim]
+	q.messages[victim] = item
+	return dropped
+}
+
+// requeue puts a message back to the queue after a failed attempt. It keeps its place in the order.
+func (q *outgoingQueue) requeue(item *queuedMessage) {
+	q.messages = append(q.messages, item)
+}
+
+// next removes and returns the first message whose channel is not rate limited. If there is none, the time until
+// the first message can be sent is returned.
+func (q *outgoingQueue) next(limiter *rateLimiter, now time.Time) (*queuedMessage, time.Duration) {
+	first := -1
+	var wait time.Duration
+	for i, queued := range q.messages {
+		delay := limiter.delay(queued.key(), now)
+		if delay > 0 {
+			if wait == 0 || delay < wait {
+				wait = delay
+			}
+			continue
+		}
+		if first == -1 || isBefore(queued, q.messages[first]) {
+			first = i
+		}
+	}
+	if first == -1 {
+		return nil, wait
+	}
+	item := q.messages[first]
+	q.messages = append(q.messages[:first], q.messages[first+1:]...)
+	return item, 0
+}
+
+// isBefore tells if the message a should be sent before the message b
+func isBefore(a *queuedMessage, b *queuedMessage) bool {
+	rankA := priorityRank(a.msg.Priority)
+	rankB := priorityRank(b.msg.Priority)
+	if rankA != rankB {
+		return rankA > rankB
+	}
+	return a.seq < b.seq
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter has a token bucket for each channel, and a pause for all channels after a rate limit error
+type rateLimiter struct {
+	interval    time.Duration
+	burst       float64
+	buckets     map[string]*tokenBucket
+	pausedUntil time.Time
+}
+
+func newRateLimiter(interval time.Duration, burst uint) *rateLimiter {
+	if burst == 0 {
+		burst = 1
+	}
+	return &rateLimiter{
+		interval: interval,
+		burst:    float64(burst),
+		buckets:  make(map[string]*tokenBucket),
+	}
+}
+
+// refill returns the bucket of the key with the tokens added since the last update
+func (l *rateLimiter) refill(key string, now time.Time) *tokenBucket {
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = bucket
+	}
+	if l.interval > 0 && now.After(bucket.updated) {
+		bucket.tokens += float64(now.Sub(bucket.updated)) / float64(l.interval)
+		if bucket.tokens > l.burst {
+			bucket.tokens = l.burst
+		}
+	}
+	bucket.updated = now
+	return bucket
+}
+
+// delay returns how long the message to the key must wait, zero if it can be sent now
+func (l *rateLimiter) delay(key string, now time.Time) time.Duration {
+	if key == "" {
+		return 0
+	}
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+	if l.interval <= 0 {
+		return 0
+	}
+	bucket := l.refill(key, now)
+	if bucket.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - bucket.tokens) * float64(l.interval))
+}
+
+// take uses a token of the key
+func (l *rateLimiter) take(key string, now time.Time) {
+	if key == "" || l.interval <= 0 {
+		return
+	}
+	l.refill(key, now).tokens--
+	l.prune(now)
+}
+
+// pause stops sending to all channels for the duration
+func (l *rateLimiter) pause(duration time.Duration, now time.Time) {
+	if until := now.Add(duration); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// prune removes the buckets that have been refilled, so that the map does not grow with every channel
+func (l *rateLimiter) prune(now time.Time) {
+	full := time.Duration(l.burst * float64(l.interval))
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.updated) > full {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package slackconnection
+
+import (
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func TestRateLimiterTokenBucket(t *testing.T) {
+	limiter := newRateLimiter(time.Second, 3)
+	now := testStart
+	for i := 0; i < 3; i++ {
+		if delay := limiter.delay("C1", now); delay != 0 {
+			t.Fatalf("delay of message %d of the burst = %s, want 0", i+1, delay)
+		}
+		limiter.take("C1", now)
+	}
+	if delay := limiter.delay("C1", now); delay != time.Second {
+		t.Errorf("delay after the burst = %s, want 1s", delay)
+	}
+	if delay := limiter.delay("C2", now); delay != 0 {
+		t.Errorf("delay of another channel = %s, want 0", delay)
+	}
+
+	now = now.Add(400 * time.Millisecond)
+	if delay := limiter.delay("C1", now); delay != 600*time.Millisecond {
+		t.Errorf("delay after 400ms = %s, want 600ms", delay)
+	}
+	now = now.Add(600 * time.Millisecond)
+	if delay := limiter.delay("C1", now); delay != 0 {
+		t.Errorf("delay after the interval = %s, want 0", delay)
+	}
+	limiter.take("C1", now)
+	if delay := limiter.delay("C1", now); delay != time.Second {
+		t.Errorf("delay after using the refilled token = %s, want 1s", delay)
+	}
+}
+
+func TestRateLimiterBucketDoesNotOverfill(t *testing.T) {
+	limiter := newRateLimiter(time.Second, 2)
+	limiter.take("C1", testStart)
+	now := testStart.Add(time.Hour)
+	limiter.take("C1", now)
+	limiter.take("C1", now)
+	if delay := limiter.delay("C1", now); delay != time.Second {
+		t.Errorf("delay after a long idle time and a burst = %s, want 1s", delay)
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	limiter := newRateLimiter(0, 1)
+	for i := 0; i < 10; i++ {
+		limiter.take("C1", testStart)
+	}
+	if delay := limiter.delay("C1", testStart); delay != 0 {
+		t.Errorf("delay without an interval = %s, want 0", delay)
+	}
+
+	limiter = newRateLimiter(time.Second, 1)
+	for i := 0; i < 10; i++ {
+		limiter.take("", testStart)
+	}
+	if delay := limiter.delay("", testStart); delay != 0 {
+		t.Errorf("delay of an unlimited message = %s, want 0", delay)
+	}
+}
+
+func TestRateLimiterPause(t *testing.T) {
+	limiter := newRateLimiter(time.Second, 3)
+	limiter.pause(5*time.Second, testStart)
+	// A shorter pause does not shorten the current one
+	limiter.pause(time.Second, testStart)
+
+	for _, key := range []string{"C1", "C2"} {
+		if delay := limiter.delay(key, testStart.Add(2*time.Second)); delay != 3*time.Second {
+			t.Errorf("delay of %s during the pause = %s, want 3s", key, delay)
+		}
+	}
+	if delay := limiter.delay("", testStart); delay != 0 {
+		t.Errorf("delay of an unlimited message during the pause = %s, want 0", delay)
+	}
+	if delay := limiter.delay("C1", testStart.Add(5*time.Second)); delay != 0 {
+		t.Errorf("delay after the pause = %s, want 0", delay)
+	}
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+	limiter := newRateLimiter(time.Second, 2)
+	limiter.take("C1", testStart)
+	limiter.take("C2", testStart.Add(3*time.Second))
+	if _, found := limiter.buckets["C1"]; found {
+		t.Error("the refilled bucket of C1 was not pruned")
+	}
+	if _, found := limiter.buckets["C2"]; !found {
+		t.Error("the bucket of C2 was pruned")
+	}
+}
+
+func testMessage(channel string, text string, priority types.MessagePriority) types.OutgoingSlackMessage {
+	return types.OutgoingSlackMessage{Channel: channel, Message: text, Priority: priority}
+}
+
+// drain returns the texts of the messages in the order the queue returns them
+func drain(queue *outgoingQueue, limiter *rateLimiter, now time.Time) []string {
+	var texts []string
+	for {
+		item, _ := queue.next(limiter, now)
+		if item == nil {
+			return texts
+		}
+		texts = append(texts, item.msg.Message)
+	}
+}
+
+func equalTexts(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestOutgoingQueuePriorityOrder(t *testing.T) {
+	queue := newOutgoingQueue(10)
+	queue.push(testMessage("C1", "low", types.LowPriority))
+	queue.push(testMessage("C1", "normal 1", ""))
+	queue.push(testMessage("C1", "high", types.HighPriority))
+	queue.push(testMessage("C1", "normal 2", types.NormalPriority))
+
+	got := drain(queue, newRateLimiter(0, 1), testStart)
+	want := []string{"high", "normal 1", "normal 2", "low"}
+	if !equalTexts(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+}
+
+func TestOutgoingQueueRequeueKeepsOrder(t *testing.T) {
+	queue := newOutgoingQueue(10)
+	queue.push(testMessage("C1", "first", ""))
+	queue.push(testMessage("C1", "second", ""))
+	limiter := newRateLimiter(0, 1)
+	item, _ := queue.next(limiter, testStart)
+	item.attempts++
+	queue.requeue(item)
+
+	got := drain(queue, limiter, testStart)
+	want := []string{"first", "second"}
+	if !equalTexts(got, want) {
+		t.Errorf("order after requeue = %v, want %v", got, want)
+	}
+}
+
+func TestOutgoingQueueDropsWhenFull(t *testing.T) {
+	queue := newOutgoingQueue(2)
+	if dropped := queue.push(testMessage("C1", "normal 1", "")); dropped != nil {
+		t.Fatalf("dropped %q from a queue with room", dropped.msg.Message)
+	}
+	queue.push(testMessage("C1", "normal 2", ""))
+
+	// The newest message of the lowest priority gives way to a more important message
+	if dropped := queue.push(testMessage("C1", "high", types.HighPriority)); dropped == nil ||
+		dropped.msg.Message != "normal 2" {
+		t.Errorf("dropped %+v, want normal 2", dropped)
+	}
+	// A message that is not more important than the queued ones is dropped itself
+	if dropped := queue.push(testMessage("C1", "normal 3", "")); dropped == nil || dropped.msg.Message != "normal 3" {
+		t.Errorf("dropped %+v, want normal 3", dropped)
+	}
+	if dropped := queue.push(testMessage("C1", "low", types.LowPriority)); dropped == nil ||
+		dropped.msg.Message != "low" {
+		t.Errorf("dropped %+v, want low", dropped)
+	}
+
+	got := drain(queue, newRateLimiter(0, 1), testStart)
+	want := []string{"high", "normal 1"}
+	if !equalTexts(got, want) {
+		t.Errorf("queued = %v, want %v", got, want)
+	}
+}
+
+func TestOutgoingQueueUnbounded(t *testing.T) {
+	queue := newOutgoingQueue(0)
+	for i := 0; i < 100; i++ {
+		if dropped := queue.push(testMessage("C1", "message", "")); dropped != nil {
+			t.Fatalf("message %d was dropped from an unbounded queue", i+1)
+		}
+	}
+	if queue.len() != 100 {
+		t.Errorf("len = %d, want 100", queue.len())
+	}
+}
+
+func TestOutgoingQueueSkipsLimitedChannels(t *testing.T) {
+	queue := newOutgoingQueue(10)
+	limiter := newRateLimiter(time.Second, 1)
+	limiter.take("C1", testStart)
+	queue.push(testMessage("C1", "limited", types.HighPriority))
+	queue.push(testMessage("C2", "free", types.LowPriority))
+
+	item, wait := queue.next(limiter, testStart)
+	if item == nil || item.msg.Message != "free" {
+		t.Fatalf("next = %+v, want the message to the channel that is not limited", item)
+	}
+	limiter.take(item.key(), testStart)
+
+	item, wait = queue.next(limiter, testStart.Add(300*time.Millisecond))
+	if item != nil || wait != 700*time.Millisecond {
+		t.Errorf("next = %+v, %s, want nothing for 700ms", item, wait)
+	}
+	item, _ = queue.next(limiter, testStart.Add(time.Second))
+	if item == nil || item.msg.Message != "limited" {
+		t.Errorf("next after the interval = %+v, want the limited message", item)
+	}
+}
@@ -0,0 +1,58 @@
+package slackconnection
+
+import (
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackutilsx"
+	"github.com/slack-go/slack/socketmode"
+	"strings"
+)
+
+func (b *Bot) slashCommandHandler(evt *socketmode.Event, client *socketmode.Client) {
+	command, ok := evt.Data.(slack.SlashCommand)
+	if !ok {
+		b.logger.Debugf("> Ignored %+v", evt)
+		return
+	}
+	// Acknowledge immediately, Slack shows an error to the user if there is no response within 3 seconds. The
+	// replies are posted to the response url.
+	client.Ack(*evt.Request)
+	b.logger.Debugf("SlashCommand: %+v", command)
+
+	b.IncomingMessageChannel <- SlackMessage{
+		User:          command.UserID,
+		Text:          strings.TrimSpace(command.Text),
+		Channel:       command.ChannelID,
+		Mentioned:     true,
+		DirectMessage: strings.HasPrefix(command.ChannelID, "D"),
+		SlashCommand:  command.Command,
+		ResponseURL:   command.ResponseURL,
+		TriggerID:     command.TriggerID,
+	}
+}
+
+// postResponse replies to a slash command through its response url
+func (b *Bot) postResponse(msg types.OutgoingSlackMessage) error {
+	responseType := msg.ResponseType
+	if responseType == "" {
+		responseType = types.EphemeralResponse
+	}
+	text := msg.Message
+	if msg.EscapeText {
+		text = slackutilsx.EscapeMessage(text)
+	}
+	response := &slack.WebhookMessage{
+		Text:         text,
+		Attachments:  msg.Attachments,
+		ResponseType: responseType,
+	}
+	if msg.Blocks != nil && len(msg.Blocks.BlockSet) > 0 {
+		response.Blocks = msg.Blocks
+	}
+	if err := slack.PostWebhook(msg.ResponseURL, response); err != nil {
+		b.logger.Errorf("failed posting the response to a slash command: %v", err)
+		b.logger.Debugf("Message: %s", msg.Message)
+		return err
+	}
+	return nil
+}
@@ -2,6 +2,9 @@ package slackconnection
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/blissfulreboot/slagbot/internal/metrics"
 	"github.com/blissfulreboot/slagbot/pkg/interfaces"
 	"github.com/blissfulreboot/slagbot/pkg/types"
 	"github.com/slack-go/slack"
@@ -9,28 +12,68 @@ import (
 	"github.com/slack-go/slack/socketmode"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// Maximum time to post the remaining outgoing messages on shutdown
+const outgoingFlushTimeout = 30 * time.Second
+
 /*
 This code is based on the socketmode event handler example:
 https://github.com/slack-go/slack/blob/master/examples/socketmode_handler/socketmode_handler.go
 */
 
 type SlackMessage struct {
-	User    string
-	Text    string
-	Channel string
+	User            string
+	Text            string
+	Channel         string
+	Timestamp       string
+	ThreadTimestamp string
+	// Mentioned is true if the bot was mentioned in the message. The mention is removed from the Text.
+	Mentioned bool
+	// DirectMessage is true if the message was sent directly to the bot
+	DirectMessage bool
+	// SlashCommand is set if the message is the text of a slash command, e.g. "/deploy". There is no Timestamp then,
+	// and the replies go to the ResponseURL.
+	SlashCommand string
+	ResponseURL  string
+	TriggerID    string
 }
 
 type Bot struct {
 	IncomingMessageChannel chan SlackMessage
 	OutgoingMessageChannel chan types.OutgoingSlackMessage
+	InteractionChannel     chan SlackInteraction
 	client                 *socketmode.Client
 	slackbotSelfId         string
+	users                  *userCache
+	userGroups             *userGroupCache
+	recentMessages         *recentMessages
+	flushUntil             <-chan struct{}
+	done                   <-chan struct{}
+	outgoing               *outgoingQueue
+	outgoingQueued         int64
+	limiter                *rateLimiter
+	maxRetries             uint
+	splitLength            int
+	uploadLength           int
 	logger                 interfaces.LoggerInterface
 }
 
-func NewBot(appToken string, botToken string, logger interfaces.LoggerInterface) (*Bot, error) {
+// OutgoingOptions configures how the outgoing messages are queued, rate limited and split. Zero QueueSize means that
+// the queue is not bounded, and zero UploadLength that long messages are never uploaded as files.
+type OutgoingOptions struct {
+	ChannelIntervalMillis uint
+	ChannelBurst          uint
+	QueueSize             uint
+	MaxRetries            uint
+	SplitLength           uint
+	UploadLength          uint
+}
+
+func NewBot(appToken string, botToken string, outgoing OutgoingOptions, logger interfaces.LoggerInterface) (*Bot,
+	error) {
 	if appToken == "" {
 		panic("SLACK_APP_TOKEN must be set.\n")
 	}
@@ -64,16 +107,31 @@ func NewBot(appToken string, botToken string, logger interfaces.LoggerInterface)
 		api,
 	)
 
-	return &Bot{
+	channelInterval := time.Duration(outgoing.ChannelIntervalMillis) * time.Millisecond
+	bot := &Bot{
 		IncomingMessageChannel: make(chan SlackMessage),
 		OutgoingMessageChannel: make(chan types.OutgoingSlackMessage),
+		InteractionChannel:     make(chan SlackInteraction, interactionQueueSize),
 		client:                 client,
 		slackbotSelfId:         slackbotSelfId,
+		users:                  newUserCache(),
+		userGroups:             newUserGroupCache(),
+		recentMessages:         newRecentMessages(),
+		outgoing:               newOutgoingQueue(outgoing.QueueSize),
+		limiter:                newRateLimiter(channelInterval, outgoing.ChannelBurst),
+		maxRetries:             outgoing.MaxRetries,
+		splitLength:            int(outgoing.SplitLength),
+		uploadLength:           int(outgoing.UploadLength),
 		logger:                 logger,
-	}, nil
+	}
+	metrics.Gauge("outgoing_queue", func() interface{} {
+		return atomic.LoadInt64(&bot.outgoingQueued)
+	})
+	return bot, nil
 }
 
 func (b *Bot) Start(wg *sync.WaitGroup, ctx context.Context) {
+	b.done = ctx.Done()
 	socketmodeHandler := socketmode.NewSocketmodeHandler(b.client)
 
 	socketmodeHandler.Handle(socketmode.EventTypeConnecting, b.middlewareConnecting)
@@ -88,6 +146,11 @@ func (b *Bot) Start(wg *sync.WaitGroup, ctx context.Context) {
 	socketmodeHandler.HandleEvents(slackevents.AppMention, b.incomingMessageHandler)
 	socketmodeHandler.HandleEvents(slackevents.Message, b.incomingMessageHandler)
 
+	// Clicks of buttons and menus, and submissions of modals
+	socketmodeHandler.Handle(socketmode.EventTypeInteractive, b.interactionHandler)
+
+	socketmodeHandler.Handle(socketmode.EventTypeSlashCommand, b.slashCommandHandler)
+
 	// Channels for incoming and outgoing messages must be created before starting the handler loops
 
 	go socketmodeHandler.RunEventLoop()
@@ -115,72 +178,250 @@ func (b *Bot) incomingMessageHandler(evt *socketmode.Event, client *socketmode.C
 	}
 	client.Ack(*evt.Request)
 
+	if slackMessage, ok := b.receiveMessage(eventsAPIEvent.InnerEvent.Data); ok {
+		b.IncomingMessageChannel <- slackMessage
+	}
+}
+
+// receiveMessage converts a message event to a SlackMessage. False is returned for unknown events, the bot's own
+// messages and the messages that have already been received as another event.
+func (b *Bot) receiveMessage(event interface{}) (SlackMessage, bool) {
 	var slackMessage SlackMessage
 
-	switch eventData := eventsAPIEvent.InnerEvent.Data.(type) {
+	switch eventData := event.(type) {
 	case *slackevents.AppMentionEvent:
 		b.logger.Debugf("AppMentionEvent: %+v", eventData)
 		slackMessage = SlackMessage{
-			User:    eventData.User,
-			Text:    eventData.Text,
-			Channel: eventData.Channel,
+			User:            eventData.User,
+			Text:            eventData.Text,
+			Channel:         eventData.Channel,
+			Timestamp:       eventData.TimeStamp,
+			ThreadTimestamp: eventData.ThreadTimeStamp,
+			Mentioned:       true,
+			DirectMessage:   strings.HasPrefix(eventData.Channel, "D"),
 		}
 	case *slackevents.MessageEvent:
 		b.logger.Debugf("MessageEvent: %+v", eventData)
 		slackMessage = SlackMessage{
-			User:    eventData.User,
-			Text:    eventData.Text,
-			Channel: eventData.Channel,
+			User:            eventData.User,
+			Text:            eventData.Text,
+			Channel:         eventData.Channel,
+			Timestamp:       eventData.TimeStamp,
+			ThreadTimestamp: eventData.ThreadTimeStamp,
+			DirectMessage:   eventData.ChannelType == "im",
 		}
 	default:
 		b.logger.Error("Unknown message event")
 		b.logger.Debugf("Data: %+v", eventData)
+		return slackMessage, false
 	}
 
 	if slackMessage.User == b.slackbotSelfId {
 		b.logger.Debugf("Ignoring own message: %+v", slackMessage)
-		return
+		return slackMessage, false
 	}
 
-	b.logger.Debugf("slackMessage: %+v", slackMessage)
+	if b.recentMessages.seen(slackMessage.Channel, slackMessage.Timestamp) {
+		b.logger.Debugf("Ignoring already received message: %+v", slackMessage)
+		return slackMessage, false
+	}
 
-	b.IncomingMessageChannel <- slackMessage
+	mention := fmt.Sprintf("<@%s>", b.slackbotSelfId)
+	if strings.Contains(slackMessage.Text, mention) {
+		slackMessage.Mentioned = true
+	}
+	slackMessage.Text = strings.TrimSpace(strings.ReplaceAll(slackMessage.Text, mention, ""))
+
+	b.logger.Debugf("slackMessage: %+v", slackMessage)
+	return slackMessage, true
+}
 
+// FlushMessagesUntil makes the bot keep posting the outgoing messages after the context is done, until the channel is
+// closed. This allows the plugins to send their last messages while they are being stopped. It must be called before
+// Start.
+func (b *Bot) FlushMessagesUntil(done <-chan struct{}) {
+	b.flushUntil = done
 }
 
 func (b *Bot) startOutgoingMessageHandler(wg *sync.WaitGroup, ctx context.Context) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		for {
-			select {
-			case msg := <-b.OutgoingMessageChannel:
-				var channelId string
-				if msg.Channel != "" {
-					channelId = msg.Channel
-				} else if msg.UserEmail != "" {
-					b.logger.Debug(msg.UserEmail)
-					user, getUserErr := b.client.GetUserByEmail(msg.UserEmail)
-					if getUserErr != nil {
-						b.logger.Errorf("User with email %s not found", msg.UserEmail)
-						b.logger.Debug(getUserErr)
-						continue
-					}
-					channelId = user.ID
-				} else {
-					b.logger.Error("User email and channel id cannot both be nil. Message was not sent.")
-					b.logger.Debugf("Message: %s", msg.Message)
-				}
-				_, _, err := b.client.Client.PostMessage(channelId, slack.MsgOptionText(msg.Message, false))
-				if err != nil {
-					b.logger.Errorf("failed posting message: %v", err)
-					b.logger.Debugf("Message: %s, Channel: %s", msg.Message, channelId)
-				}
-			case <-ctx.Done():
-				b.logger.Debug("Context done in startOutgoingMessageHandler")
-				return
-			}
-		}
+		b.runOutgoingQueue(ctx)
 	}()
 	b.logger.Debug("startOutgoingMessageHandler Done")
 }
+
+// runOutgoingQueue queues the outgoing messages and sends them as fast as the rate limits allow. After the context is
+// done, the queued messages and the messages sent until flushUntil is closed are still posted, for at most
+// outgoingFlushTimeout.
+func (b *Bot) runOutgoingQueue(ctx context.Context) {
+	done := ctx.Done()
+	var flushUntil <-chan struct{}
+	var flushTimeout <-chan time.Time
+	for {
+		// Queue the waiting messages first, so that their priorities are taken into account
+		b.acceptOutgoing()
+		item, wait := b.outgoing.next(b.limiter, time.Now())
+		atomic.StoreInt64(&b.outgoingQueued, int64(b.outgoing.len()))
+		if item != nil {
+			b.sendQueued(item)
+			continue
+		}
+		if done == nil && flushUntil == nil && b.outgoing.len() == 0 {
+			return
+		}
+
+		var retryTimer *time.Timer
+		var retry <-chan time.Time
+		if wait > 0 {
+			retryTimer = time.NewTimer(wait)
+			retry = retryTimer.C
+		}
+		select {
+		case msg := <-b.OutgoingMessageChannel:
+			b.queueMessage(msg)
+		case <-retry:
+		case <-done:
+			b.logger.Debug("Context done in startOutgoingMessageHandler")
+			done = nil
+			flushUntil = b.flushUntil
+			flushTimer := time.NewTimer(outgoingFlushTimeout)
+			defer flushTimer.Stop()
+			flushTimeout = flushTimer.C
+		case <-flushUntil:
+			flushUntil = nil
+		case <-flushTimeout:
+			b.logger.Errorf("Timeout while posting the outgoing messages on shutdown, %d messages were not sent",
+				b.outgoing.len())
+			metrics.OutgoingDropped.Add("shutdown", int64(b.outgoing.len()))
+			return
+		}
+		if retryTimer != nil {
+			retryTimer.Stop()
+		}
+	}
+}
+
+// acceptOutgoing queues the messages that are waiting in the channel without blocking
+func (b *Bot) acceptOutgoing() {
+	for {
+		select {
+		case msg := <-b.OutgoingMessageChannel:
+			b.queueMessage(msg)
+		default:
+			return
+		}
+	}
+}
+
+func (b *Bot) queueMessage(msg types.OutgoingSlackMessage) {
+	for _, part := range b.prepareMessage(msg) {
+		dropped := b.outgoing.push(part)
+		if dropped == nil {
+			continue
+		}
+		b.logger.Errorf("The outgoing message queue is full, dropped a message to %s", dropped.key())
+		b.logger.Debugf("Message: %s", dropped.msg.Message)
+		metrics.OutgoingDropped.Add("queue_full", 1)
+		b.sendResult(dropped.msg, types.OutgoingResult{Channel: dropped.msg.Channel, Err: types.ErrQueueFull})
+	}
+}
+
+// sendQueued sends the message and retries it later if Slack responds with a rate limit error
+func (b *Bot) sendQueued(item *queuedMessage) {
+	now := time.Now()
+	b.limiter.take(item.key(), now)
+	result := b.sendMessage(item.msg)
+	var rateLimitErr *slack.RateLimitedError
+	if errors.As(result.Err, &rateLimitErr) {
+		if item.attempts < b.maxRetries {
+			item.attempts++
+			b.logger.Warnf("Rate limited by Slack, retrying the message to %s in %s", item.key(),
+				rateLimitErr.RetryAfter)
+			metrics.OutgoingRetries.Add(1)
+			b.limiter.pause(rateLimitErr.RetryAfter, now)
+			b.outgoing.requeue(item)
+			return
+		}
+		b.logger.Errorf("Rate limited by Slack, dropped the message to %s after %d retries", item.key(),
+			item.attempts)
+		metrics.OutgoingDropped.Add("rate_limited", 1)
+	}
+	b.sendResult(item.msg, result)
+}
+
+func (b *Bot) sendResult(msg types.OutgoingSlackMessage, result types.OutgoingResult) {
+	if msg.Result == nil {
+		return
+	}
+	select {
+	case msg.Result <- result:
+	default:
+		b.logger.Errorf("The result channel of a message to %s is full, the result was dropped", result.Channel)
+	}
+}
+
+func (b *Bot) sendMessage(msg types.OutgoingSlackMessage) types.OutgoingResult {
+	if msg.View != nil {
+		return types.OutgoingResult{Err: b.openView(msg)}
+	}
+	if msg.ResponseURL != "" {
+		return types.OutgoingResult{Channel: msg.Channel, Err: b.postResponse(msg)}
+	}
+	var channelId string
+	if msg.Channel != "" {
+		channelId = msg.Channel
+	} else if msg.UserEmail != "" {
+		b.logger.Debug(msg.UserEmail)
+		user, getUserErr := b.client.GetUserByEmail(msg.UserEmail)
+		if getUserErr != nil {
+			b.logger.Errorf("User with email %s not found", msg.UserEmail)
+			b.logger.Debug(getUserErr)
+			var slackErr slack.SlackErrorResponse
+			if errors.As(getUserErr, &slackErr) && slackErr.Err == "users_not_found" {
+				return types.OutgoingResult{Err: &types.RecipientNotFoundError{Email: msg.UserEmail}}
+			}
+			return types.OutgoingResult{Err: getUserErr}
+		}
+		channelId = user.ID
+	} else {
+		b.logger.Error("User email and channel id cannot both be nil. Message was not sent.")
+		b.logger.Debugf("Message: %s", msg.Message)
+		return types.OutgoingResult{Err: errors.New("the message has neither a channel nor a user email")}
+	}
+	result, err := b.runOperation(channelId, msg)
+	if err != nil {
+		// Rate limits are logged when the message is retried
+		var rateLimitErr *slack.RateLimitedError
+		if !errors.As(err, &rateLimitErr) {
+			b.logger.Errorf("failed to %s message: %v", operationName(msg.Operation), err)
+			b.logger.Debugf("Message: %s, Channel: %s", msg.Message, channelId)
+		}
+		return types.OutgoingResult{Channel: channelId, Err: err}
+	}
+	return result
+}
+
+func messageOptions(msg types.OutgoingSlackMessage) []slack.MsgOption {
+	options := []slack.MsgOption{slack.MsgOptionText(msg.Message, msg.EscapeText)}
+	if msg.ThreadTimestamp != "" {
+		options = append(options, slack.MsgOptionTS(msg.ThreadTimestamp))
+		if msg.BroadcastToChannel {
+			options = append(options, slack.MsgOptionBroadcast())
+		}
+	}
+	if msg.Blocks != nil && len(msg.Blocks.BlockSet) > 0 {
+		options = append(options, slack.MsgOptionBlocks(msg.Blocks.BlockSet...))
+	}
+	if len(msg.Attachments) > 0 {
+		options = append(options, slack.MsgOptionAttachments(msg.Attachments...))
+	}
+	if msg.DisableMarkdown {
+		options = append(options, slack.MsgOptionDisableMarkdown())
+	}
+	if msg.DisableUnfurl {
+		options = append(options, slack.MsgOptionDisableLinkUnfurl(), slack.MsgOptionDisableMediaUnfurl())
+	}
+	return options
+}
@@ -0,0 +1,114 @@
+package slackconnection
+
+import (
+	"github.com/blissfulreboot/slagbot/pkg/types"
+	"sync"
+	"time"
+)
+
+const userCacheTTL = time.Hour
+
+type cachedUser struct {
+	profile *types.UserProfile
+	fetched time.Time
+}
+
+type userCache struct {
+	lock  sync.Mutex
+	users map[string]cachedUser
+}
+
+func newUserCache() *userCache {
+	return &userCache{
+		users: make(map[string]cachedUser),
+	}
+}
+
+func (c *userCache) get(userID string) (*types.UserProfile, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cached, ok := c.users[userID]
+	if !ok || time.Since(cached.fetched) > userCacheTTL {
+		return nil, false
+	}
+	return cached.profile, true
+}
+
+func (c *userCache) set(profile *types.UserProfile) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.users[profile.ID] = cachedUser{
+		profile: profile,
+		fetched: time.Now(),
+	}
+}
+
+// LookupUser returns the profile of the user using users.info. The results are cached for an hour.
+func (b *Bot) LookupUser(userID string) (*types.UserProfile, error) {
+	if profile, ok := b.users.get(userID); ok {
+		return profile, nil
+	}
+	user, err := b.client.GetUserInfo(userID)
+	if err != nil {
+		return nil, err
+	}
+	profile := &types.UserProfile{
+		ID:          user.ID,
+		Name:        user.Name,
+		DisplayName: user.Profile.DisplayName,
+		RealName:    user.RealName,
+		Email:       user.Profile.Email,
+	}
+	b.users.set(profile)
+	return profile, nil
+}
+
+const userGroupCacheTTL = 10 * time.Minute
+
+type cachedUserGroup struct {
+	members []string
+	fetched time.Time
+}
+
+type userGroupCache struct {
+	lock   sync.Mutex
+	groups map[string]cachedUserGroup
+}
+
+func newUserGroupCache() *userGroupCache {
+	return &userGroupCache{
+		groups: make(map[string]cachedUserGroup),
+	}
+}
+
+func (c *userGroupCache) get(groupID string) ([]string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cached, ok := c.groups[groupID]
+	if !ok || time.Since(cached.fetched) > userGroupCacheTTL {
+		return nil, false
+	}
+	return cached.members, true
+}
+
+func (c *userGroupCache) set(groupID string, members []string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.groups[groupID] = cachedUserGroup{
+		members: members,
+		fetched: time.Now(),
+	}
+}
+
+// UserGroupMembers returns the user IDs of the members of the user group. The results are cached for ten minutes.
+func (b *Bot) UserGroupMembers(groupID string) ([]string, error) {
+	if members, ok := b.userGroups.get(groupID); ok {
+		return members, nil
+	}
+	members, err := b.client.GetUserGroupMembers(groupID)
+	if err != nil {
+		return nil, err
+	}
+	b.userGroups.set(groupID, members)
+	return members, nil
+}
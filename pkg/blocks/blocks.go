@@ -0,0 +1,97 @@
+// Package blocks has shorthands for building the common Block Kit blocks for types.OutgoingSlackMessage. For
+// anything more specific, use the constructors of github.com/slack-go/slack directly.
+package blocks
+
+import (
+	"github.com/slack-go/slack"
+)
+
+// Attachment colors
+const (
+	ColorGood    = "good"
+	ColorWarning = "warning"
+	ColorDanger  = "danger"
+)
+
+// Message collects the blocks to the Blocks field of types.OutgoingSlackMessage.
+func Message(blocks ...slack.Block) *slack.Blocks {
+	return &slack.Blocks{BlockSet: blocks}
+}
+
+// Markdown is a mrkdwn text object
+func Markdown(text string) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.MarkdownType, text, false, false)
+}
+
+// PlainText is a plain text object
+func PlainText(text string) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.PlainTextType, text, true, false)
+}
+
+// Header is a large bold plain text header
+func Header(text string) *slack.HeaderBlock {
+	return slack.NewHeaderBlock(PlainText(text))
+}
+
+// Section is a block of mrkdwn text
+func Section(text string) *slack.SectionBlock {
+	return slack.NewSectionBlock(Markdown(text), nil, nil)
+}
+
+// Fields is a section with the mrkdwn texts in two columns
+func Fields(texts ...string) *slack.SectionBlock {
+	var fields []*slack.TextBlockObject
+	for _, text := range texts {
+		fields = append(fields, Markdown(text))
+	}
+	return slack.NewSectionBlock(nil, fields, nil)
+}
+
+// Divider is a horizontal line between blocks
+func Divider() *slack.DividerBlock {
+	return slack.NewDividerBlock()
+}
+
+// Context is a line of small mrkdwn texts
+func Context(texts ...string) *slack.ContextBlock {
+	var elements []slack.MixedElement
+	for _, text := range texts {
+		elements = append(elements, Markdown(text))
+	}
+	return slack.NewContextBlock("", elements...)
+}
+
+// Image is an image block
+func Image(imageURL string, altText string) *slack.ImageBlock {
+	return slack.NewImageBlock(imageURL, altText, "", nil)
+}
+
+// Button is a button element for Actions. The action id and the value are sent back when the button is clicked.
+func Button(actionID string, text string, value string) *slack.ButtonBlockElement {
+	return slack.NewButtonBlockElement(actionID, value, PlainText(text))
+}
+
+// PrimaryButton is a green button
+func PrimaryButton(actionID string, text string, value string) *slack.ButtonBlockElement {
+	return Button(actionID, text, value).WithStyle(slack.StylePrimary)
+}
+
+// DangerButton is a red button
+func DangerButton(actionID string, text string, value string) *slack.ButtonBlockElement {
+	return Button(actionID, text, value).WithStyle(slack.StyleDanger)
+}
+
+// Actions is a block of interactive elements such as buttons
+func Actions(blockID string, elements ...slack.BlockElement) *slack.ActionBlock {
+	return slack.NewActionBlock(blockID, elements...)
+}
+
+// Attachment is a colored attachment with mrkdwn text. The color is one of the Color constants or a hex code such as
+// "#439FE0".
+func Attachment(color string, text string) slack.Attachment {
+	return slack.Attachment{
+		Color:      color,
+		Text:       text,
+		MarkdownIn: []string{"text"},
+	}
+}
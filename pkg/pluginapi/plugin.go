@@ -0,0 +1,119 @@
+// Package pluginapi is the version 2 API for Go plugins. A plugin exports a single symbol named Plugin that implements
+// the Plugin interface:
+//
+//	var Plugin pluginapi.Plugin = &myPlugin{}
+//
+// Plugins that export the legacy GetCommands, Run and Stop symbols are still supported.
+package pluginapi
+
+import (
+	"context"
+	"github.com/blissfulreboot/slagbot/pkg/interfaces"
+	"github.com/blissfulreboot/slagbot/pkg/types"
+)
+
+// Version of the plugin API
+const Version = 2
+
+// SymbolName is the name of the symbol the bot looks up from the plugin
+const SymbolName = "Plugin"
+
+// Host is the bot as seen by the plugin.
+type Host interface {
+	// Logger returns the logger of the bot
+	Logger() interfaces.LoggerInterface
+	// Send posts a message to Slack
+	Send(msg types.OutgoingSlackMessage)
+	// SendAndWait posts a message to Slack and waits until it is done. The result has the channel and the ts of the
+	// message, and the error tells why it could not be sent, e.g. a *types.RecipientNotFoundError.
+	SendAndWait(ctx context.Context, msg types.OutgoingSlackMessage) (types.OutgoingResult, error)
+}
+
+type Plugin interface {
+	// Init is called once after the plugin is loaded, before Commands. The context is cancelled when the plugin is
+	// stopped, e.g. when the bot exits or the plugin is reloaded.
+	Init(ctx context.Context, host Host) error
+	// Commands returns the commands handled by the plugin
+	Commands() []types.Command
+	// Handle is called for each command in its own goroutine, so it can block. If an error is returned, it is logged
+	// and the user is told that the command failed.
+	Handle(ctx context.Context, req *Request) error
+}
+
+// Interactive is implemented by plugins that post interactive messages or open modals. The interactions whose action
+// id (buttons and menus) or callback id (modals) starts with one of the returned prefixes are passed to Handle with
+// the Interaction field of the Request set.
+type Interactive interface {
+	InteractionIDs() []string
+}
+
+// Request is a command sent to the plugin.
+type Request struct {
+	types.ParsedCommand
+	host Host
+}
+
+func NewRequest(cmd types.ParsedCommand, host Host) *Request {
+	return &Request{
+		ParsedCommand: cmd,
+		host:          host,
+	}
+}
+
+// Reply posts the message to the channel of the command, in the same thread as the command or in a new thread under
+// the command message. The reply to a slash command is shown only to the user who gave it.
+func (r *Request) Reply(message string) {
+	r.host.Send(types.OutgoingSlackMessage{
+		Channel:         r.Channel,
+		Message:         message,
+		ThreadTimestamp: r.ReplyThreadTimestamp(),
+		ResponseURL:     r.ResponseURL,
+		ResponseType:    types.EphemeralResponse,
+	})
+}
+
+// ReplyEphemeral posts the message to the channel of the command so that only the user who gave the command sees it.
+func (r *Request) ReplyEphemeral(message string) {
+	r.host.Send(types.OutgoingSlackMessage{
+		Operation:       types.PostEphemeral,
+		Channel:         r.Channel,
+		User:            r.User.ID,
+		Message:         message,
+		ThreadTimestamp: r.ThreadTimestamp,
+		ResponseURL:     r.ResponseURL,
+		ResponseType:    types.EphemeralResponse,
+	})
+}
+
+// React adds the emoji reaction, e.g. "eyes", to the command message. Slash commands have no message to react to.
+func (r *Request) React(reaction string) {
+	r.reaction(types.AddReaction, reaction)
+}
+
+// Unreact removes the emoji reaction added with React.
+func (r *Request) Unreact(reaction string) {
+	r.reaction(types.RemoveReaction, reaction)
+}
+
+func (r *Request) reaction(operation types.OutgoingOperation, reaction string) {
+	if r.MessageTimestamp == "" {
+		return
+	}
+	r.host.Send(types.OutgoingSlackMessage{
+		Operation: operation,
+		Channel:   r.Channel,
+		Timestamp: r.MessageTimestamp,
+		Reaction:  reaction,
+	})
+}
+
+// ReplyInChannel posts the message to the channel of the command outside of any thread. The reply to a slash command
+// is shown to everyone in the channel.
+func (r *Request) ReplyInChannel(message string) {
+	r.host.Send(types.OutgoingSlackMessage{
+		Channel:      r.Channel,
+		Message:      message,
+		ResponseURL:  r.ResponseURL,
+		ResponseType: types.InChannelResponse,
+	})
+}
@@ -0,0 +1,134 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// SlackUser is the value of a UserValue parameter.
+type SlackUser struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// SlackChannel is the value of a ChannelValue parameter.
+type SlackChannel struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Arguments holds the parsed parameters of a command, keyed by the parameter keyword. Flags are stored as bool,
+// IntValue as int, FloatValue as float64, DurationValue as time.Duration, UserValue as SlackUser, ChannelValue as
+// SlackChannel and all other value types as string.
+type Arguments map[string]interface{}
+
+func (a Arguments) get(key string) (interface{}, error) {
+	value, ok := a[key]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("argument '%s' not found", key))
+	}
+	return value, nil
+}
+
+func typeError(key string, expected string, value interface{}) error {
+	return errors.New(fmt.Sprintf("argument '%s' is not %s but %T", key, expected, value))
+}
+
+func (a Arguments) Has(key string) bool {
+	_, ok := a[key]
+	return ok
+}
+
+func (a Arguments) String(key string) (string, error) {
+	value, err := a.get(key)
+	if err != nil {
+		return "", err
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", typeError(key, "a string", value)
+	}
+	return s, nil
+}
+
+func (a Arguments) Bool(key string) (bool, error) {
+	value, err := a.get(key)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, typeError(key, "a bool", value)
+	}
+	return b, nil
+}
+
+func (a Arguments) Int(key string) (int, error) {
+	value, err := a.get(key)
+	if err != nil {
+		return 0, err
+	}
+	i, ok := value.(int)
+	if !ok {
+		return 0, typeError(key, "an int", value)
+	}
+	return i, nil
+}
+
+func (a Arguments) Float(key string) (float64, error) {
+	value, err := a.get(key)
+	if err != nil {
+		return 0, err
+	}
+	f, ok := value.(float64)
+	if !ok {
+		return 0, typeError(key, "a float", value)
+	}
+	return f, nil
+}
+
+func (a Arguments) Duration(key string) (time.Duration, error) {
+	value, err := a.get(key)
+	if err != nil {
+		return 0, err
+	}
+	d, ok := value.(time.Duration)
+	if !ok {
+		return 0, typeError(key, "a duration", value)
+	}
+	return d, nil
+}
+
+func (a Arguments) User(key string) (SlackUser, error) {
+	value, err := a.get(key)
+	if err != nil {
+		return SlackUser{}, err
+	}
+	u, ok := value.(SlackUser)
+	if !ok {
+		return SlackUser{}, typeError(key, "a user", value)
+	}
+	return u, nil
+}
+
+func (a Arguments) Channel(key string) (SlackChannel, error) {
+	value, err := a.get(key)
+	if err != nil {
+		return SlackChannel{}, err
+	}
+	c, ok := value.(SlackChannel)
+	if !ok {
+		return SlackChannel{}, typeError(key, "a channel", value)
+	}
+	return c, nil
+}
+
+func (a Arguments) URL(key string) (*url.URL, error) {
+	s, err := a.String(key)
+	if err != nil {
+		return nil, err
+	}
+	return url.Parse(s)
+}
@@ -0,0 +1,43 @@
+package types
+
+type InteractionType string
+
+const (
+	// BlockAction is a click of a button or a selection in a menu of a message or a modal
+	BlockAction InteractionType = "block_action"
+	// ViewSubmission is the submission of a modal
+	ViewSubmission InteractionType = "view_submission"
+	// ViewClosed is sent when a modal opened with NotifyOnClose is closed
+	ViewClosed InteractionType = "view_closed"
+)
+
+// Interaction is a user's interaction with a message or a modal posted by the plugin. It is delivered to the plugin
+// that registered a prefix of the action id (block actions) or the callback id (modals) in the ParsedCommand's
+// Interaction field.
+type Interaction struct {
+	Type InteractionType `json:"type"`
+	// ActionID and BlockID identify the element of a block action
+	ActionID string `json:"action_id,omitempty"`
+	BlockID  string `json:"block_id,omitempty"`
+	// Value is the value of the clicked button or the selected option, user, channel, date or time
+	Value string `json:"value,omitempty"`
+	// SelectedValues are the values of a multi-select menu
+	SelectedValues []string `json:"selected_values,omitempty"`
+	// CallbackID, ViewID and PrivateMetadata identify the modal of a view submission
+	CallbackID      string `json:"callback_id,omitempty"`
+	ViewID          string `json:"view_id,omitempty"`
+	PrivateMetadata string `json:"private_metadata,omitempty"`
+	// Values are the values of the inputs of a submitted modal keyed by the action id of the input element
+	Values map[string]string `json:"values,omitempty"`
+	// TriggerID can be used for opening a modal for a few seconds after the interaction
+	TriggerID   string `json:"trigger_id,omitempty"`
+	ResponseURL string `json:"response_url,omitempty"`
+}
+
+// ID is the action id of a block action or the callback id of a modal, used for routing the interaction.
+func (i Interaction) ID() string {
+	if i.Type == BlockAction {
+		return i.ActionID
+	}
+	return i.CallbackID
+}
@@ -6,24 +6,98 @@ const (
 	Before ParameterType = "before"
 	After  ParameterType = "after"
 	Flag   ParameterType = "flag"
+	// Positional takes the next word after the command keyword that is not part of another parameter. The Keyword
+	// of a positional parameter is only used as its name.
+	Positional ParameterType = "positional"
+	// Rest takes all the remaining text after the positional parameters
+	Rest ParameterType = "rest"
+)
+
+// ValueType defines how the value of a before/after parameter is converted and validated. See Arguments for the Go
+// types of the converted values.
+type ValueType string
+
+const (
+	StringValue   ValueType = "string"
+	IntValue      ValueType = "int"
+	FloatValue    ValueType = "float"
+	DurationValue ValueType = "duration"
+	EnumValue     ValueType = "enum"
+	UserValue     ValueType = "user"
+	ChannelValue  ValueType = "channel"
+	EmailValue    ValueType = "email"
+	URLValue      ValueType = "url"
 )
 
 type Parameter struct {
-	Keyword     string
-	Description string
-	Type        ParameterType
+	Keyword     string        `json:"keyword"`
+	Description string        `json:"description"`
+	Type        ParameterType `json:"type"`
+	// ValueType defaults to StringValue
+	ValueType ValueType `json:"value_type,omitempty"`
+	// Choices lists the accepted values of an EnumValue parameter
+	Choices []string `json:"choices,omitempty"`
+	// Pattern is a regular expression that the whole value must match
+	Pattern string `json:"pattern,omitempty"`
+	// Optional lets the command be used without the parameter. Other parameters than flags are required by default.
+	Optional bool `json:"optional,omitempty"`
+	// Default is stored in the arguments when an optional parameter is missing. If Default is nil, the argument is
+	// left out. The default is converted like a value given in the message when the plugin is loaded, and a plugin
+	// with an invalid default is not loaded.
+	Default interface{} `json:"default,omitempty"`
 }
 
-type Arguments map[string]interface{}
-
 type Command struct {
-	Keyword     string
-	Description string
-	Params      []Parameter
+	Keyword     string      `json:"keyword"`
+	Description string      `json:"description"`
+	Params      []Parameter `json:"params"`
+	// RequiredRole is the role needed to use the command unless the bot configuration defines a policy for it
+	RequiredRole string `json:"required_role,omitempty"`
+	// Subcommands are matched after the keyword of this command, e.g. "create" in "jira issue create"
+	Subcommands []Command `json:"subcommands,omitempty"`
+	// SlashCommand also exposes the command as a Slack slash command, e.g. "/deploy". The text after the slash
+	// command is parsed like the text after the keyword in a message, including the subcommands.
+	SlashCommand string `json:"slash_command,omitempty"`
+}
+
+// Flatten returns the command and all its subcommands with the full keyword path as the Keyword, e.g.
+// "jira issue create". Subcommands inherit the RequiredRole of the parent if they do not define one.
+func (c Command) Flatten() []Command {
+	commands := []Command{c}
+	for _, sub := range c.Subcommands {
+		sub.Keyword = c.Keyword + " " + sub.Keyword
+		if sub.RequiredRole == "" {
+			sub.RequiredRole = c.RequiredRole
+		}
+		commands = append(commands, sub.Flatten()...)
+	}
+	return commands
 }
 
 type ParsedCommand struct {
-	Channel   string
-	Command   string
-	Arguments Arguments
+	Channel   string    `json:"channel"`
+	User      User      `json:"user"`
+	Command   string    `json:"command"`
+	Arguments Arguments `json:"arguments"`
+	// MessageTimestamp is the ts of the message that contained the command
+	MessageTimestamp string `json:"message_ts"`
+	// ThreadTimestamp is the ts of the thread's parent message, empty if the message was not in a thread
+	ThreadTimestamp string `json:"thread_ts"`
+	// Interaction is set instead of the Command and Arguments when the user interacted with a message or a modal
+	// posted by the plugin. MessageTimestamp is then the ts of the message that contained the element.
+	Interaction *Interaction `json:"interaction,omitempty"`
+	// ResponseURL is set when the command was given as a slash command. There is no message, so the replies should
+	// set it in the OutgoingSlackMessage instead of a thread ts.
+	ResponseURL string `json:"response_url,omitempty"`
+	// TriggerID can be used for opening a modal for a few seconds after a slash command
+	TriggerID string `json:"trigger_id,omitempty"`
+}
+
+// ReplyThreadTimestamp returns the thread ts that a reply to the command should use to stay in the same thread as
+// the command, or to start a new thread under the command message.
+func (pc ParsedCommand) ReplyThreadTimestamp() string {
+	if pc.ThreadTimestamp != "" {
+		return pc.ThreadTimestamp
+	}
+	return pc.MessageTimestamp
 }
@@ -1,7 +1,131 @@
 package types
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/slack-go/slack"
+)
+
+// Response types of a reply to a slash command
+const (
+	// EphemeralResponse is shown only to the user who gave the slash command
+	EphemeralResponse = "ephemeral"
+	// InChannelResponse is shown to everyone in the channel
+	InChannelResponse = "in_channel"
+)
+
+// OutgoingOperation tells what the bot does with an OutgoingSlackMessage
+type OutgoingOperation string
+
+const (
+	// PostMessage posts a new message (default)
+	PostMessage OutgoingOperation = "post"
+	// PostEphemeral posts a message that is visible only to the User
+	PostEphemeral OutgoingOperation = "ephemeral"
+	// UpdateMessage replaces the text, blocks and attachments of the message with the Timestamp
+	UpdateMessage OutgoingOperation = "update"
+	// DeleteMessage deletes the message with the Timestamp
+	DeleteMessage OutgoingOperation = "delete"
+	// AddReaction adds the Reaction to the message with the Timestamp
+	AddReaction OutgoingOperation = "add_reaction"
+	// RemoveReaction removes the Reaction from the message with the Timestamp
+	RemoveReaction OutgoingOperation = "remove_reaction"
+	// UploadFile uploads the Message as a text file named FileName
+	UploadFile OutgoingOperation = "upload"
+)
+
+// MessagePriority orders the messages waiting in the outgoing queue of the bot
+type MessagePriority string
+
+const (
+	LowPriority    MessagePriority = "low"
+	NormalPriority MessagePriority = "normal"
+	HighPriority   MessagePriority = "high"
+)
+
+// ErrQueueFull is the Err of the result when the message was dropped because the outgoing queue of the bot was full
+var ErrQueueFull = errors.New("the outgoing message queue is full")
+
+// OutgoingResult tells where the message ended up. Channel and Timestamp identify the posted or updated message, so
+// that it can be updated, deleted or reacted to later. Timestamp is empty if the operation failed, and for modals,
+// file uploads and replies to slash commands, which Slack does not return a ts for.
+type OutgoingResult struct {
+	Channel   string `json:"channel"`
+	Timestamp string `json:"ts"`
+	// Err tells why the operation failed, e.g. a *RecipientNotFoundError or a slack.SlackErrorResponse such as
+	// "channel_not_found". It is nil on success.
+	Err error `json:"-"`
+}
+
+// RecipientNotFoundError is the Err of the result when no Slack user has the UserEmail of the message
+type RecipientNotFoundError struct {
+	Email string
+}
+
+func (e *RecipientNotFoundError) Error() string {
+	return fmt.Sprintf("no user found with email %s", e.Email)
+}
+
+// Send sends the message through the channel to the bot and waits until the operation is done. The error is the Err
+// of the result, or the error of the context if it is done first. The Result field of the message is overwritten.
+func Send(ctx context.Context, messages chan<- OutgoingSlackMessage, msg OutgoingSlackMessage) (OutgoingResult, error) {
+	result := make(chan OutgoingResult, 1)
+	msg.Result = result
+	select {
+	case messages <- msg:
+	case <-ctx.Done():
+		return OutgoingResult{}, ctx.Err()
+	}
+	select {
+	case outgoingResult := <-result:
+		return outgoingResult, outgoingResult.Err
+	case <-ctx.Done():
+		return OutgoingResult{}, ctx.Err()
+	}
+}
+
 type OutgoingSlackMessage struct {
-	Channel   string
-	UserEmail string
-	Message   string
+	Channel   string `json:"channel"`
+	UserEmail string `json:"user_email"`
+	// Message is the text of the message. When Blocks are given, it is shown in the notifications only.
+	Message string `json:"message"`
+	// ThreadTimestamp posts the message as a reply to the thread whose parent message has this ts
+	ThreadTimestamp string `json:"thread_ts"`
+	// BroadcastToChannel makes a thread reply visible also in the channel
+	BroadcastToChannel bool `json:"broadcast_to_channel"`
+	// Blocks is an optional Block Kit layout, see the blocks package for building the common blocks
+	Blocks *slack.Blocks `json:"blocks,omitempty"`
+	// Attachments are the legacy secondary attachments, e.g. for a colored bar next to the message
+	Attachments []slack.Attachment `json:"attachments,omitempty"`
+	// EscapeText escapes &, < and > in the Message, so that they are not treated as Slack markup
+	EscapeText bool `json:"escape_text,omitempty"`
+	// DisableMarkdown posts the Message as plain text without mrkdwn formatting
+	DisableMarkdown bool `json:"disable_markdown,omitempty"`
+	// DisableUnfurl prevents the previews of the links and media in the message
+	DisableUnfurl bool `json:"disable_unfurl,omitempty"`
+	// View opens a modal instead of posting a message. TriggerID must be the one of a recent interaction.
+	View      *slack.ModalViewRequest `json:"view,omitempty"`
+	TriggerID string                  `json:"trigger_id,omitempty"`
+	// ResponseURL replies to a slash command through its response url instead of posting to the Channel. The url can
+	// be used five times within 30 minutes of the command.
+	ResponseURL string `json:"response_url,omitempty"`
+	// ResponseType of a reply to a slash command, EphemeralResponse (default) or InChannelResponse
+	ResponseType string `json:"response_type,omitempty"`
+	// Operation defaults to PostMessage
+	Operation OutgoingOperation `json:"operation,omitempty"`
+	// Timestamp is the ts of the message to update, delete or react to
+	Timestamp string `json:"ts,omitempty"`
+	// User is the ID of the user who sees an ephemeral message
+	User string `json:"user,omitempty"`
+	// Reaction is the name of the emoji without the colons, e.g. "white_check_mark"
+	Reaction string `json:"reaction,omitempty"`
+	// FileName of an uploaded file, also used when a long message is uploaded as a file. Defaults to "message.txt".
+	FileName string `json:"file_name,omitempty"`
+	// Priority defaults to NormalPriority. When the messages are rate limited, the messages with a higher priority
+	// are sent first, and the messages with a lower priority are dropped first when the queue is full.
+	Priority MessagePriority `json:"priority,omitempty"`
+	// Result receives the OutgoingResult when the operation is done, if it is set. The channel must have room for
+	// the result, as the bot does not wait for the plugin to receive it.
+	Result chan<- OutgoingResult `json:"-"`
 }
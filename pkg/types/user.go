@@ -0,0 +1,38 @@
+package types
+
+import "errors"
+
+type UserProfile struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	RealName    string `json:"real_name"`
+	Email       string `json:"email"`
+}
+
+// UserLookupFunc resolves the profile of a Slack user. The bot caches the results, so it is cheap to call.
+type UserLookupFunc func(userID string) (*UserProfile, error)
+
+// User is the Slack user who invoked the command. The profile is resolved only when it is asked for.
+type User struct {
+	ID     string `json:"id"`
+	lookup UserLookupFunc
+}
+
+func NewUser(id string, lookup UserLookupFunc) User {
+	return User{
+		ID:     id,
+		lookup: lookup,
+	}
+}
+
+// Profile returns the display name, real name and email of the user.
+func (u User) Profile() (*UserProfile, error) {
+	if u.ID == "" {
+		return nil, errors.New("user id is not known")
+	}
+	if u.lookup == nil {
+		return &UserProfile{ID: u.ID}, nil
+	}
+	return u.lookup(u.ID)
+}